@@ -0,0 +1,198 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/logger"
+)
+
+// Kind is the category of an error, it decides the status of the response
+type Kind string
+
+const (
+	NotFound Kind = "not-found"
+	Conflict Kind = "conflict"
+	// PreconditionFailed is a conditional request whose condition doesn't hold
+	PreconditionFailed Kind = "precondition-failed"
+	Validation         Kind = "validation"
+	Unauthorized       Kind = "unauthorized"
+	Forbidden          Kind = "forbidden"
+	// Aborted is an operation not applied because another one it depends on failed
+	Aborted  Kind = "aborted"
+	Internal Kind = "internal"
+)
+
+var statuses = map[Kind]int{
+	NotFound:           http.StatusNotFound,
+	Conflict:           http.StatusConflict,
+	PreconditionFailed: http.StatusPreconditionFailed,
+	Validation:         http.StatusBadRequest,
+	Unauthorized:       http.StatusUnauthorized,
+	Forbidden:          http.StatusForbidden,
+	Aborted:            http.StatusFailedDependency,
+	Internal:           http.StatusInternalServerError,
+}
+
+// typePrefix identifies the problem types of this service, a kind is appended to it
+const typePrefix = "urn:companyservice:problem:"
+
+// Error is an error of the domain, its detail is meant for the client
+// while the error it wraps is only logged
+type Error struct {
+	Kind   Kind
+	Detail string
+	// Status overrides the status of the kind, for the errors of the same kind
+	// that HTTP tells apart such as 412 and 415
+	Status int
+	// Extensions are added as members of the problem details
+	Extensions map[string]interface{}
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// With returns a copy of the error with an extension member added
+func (e *Error) With(key string, value interface{}) *Error {
+	c := *e
+	c.Extensions = make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		c.Extensions[k] = v
+	}
+	c.Extensions[key] = value
+	return &c
+}
+
+// New creates an error of the given kind
+func New(kind Kind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Wrap creates an error of the given kind caused by err
+func Wrap(kind Kind, err error, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Detail: fmt.Sprintf(format, args...), Err: err}
+}
+
+// WithStatus creates an error of the given kind answered with a specific status
+func WithStatus(kind Kind, status int, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Status: status, Detail: fmt.Sprintf(format, args...)}
+}
+
+// KindOf returns the kind of an error, the errors outside of the domain are internal
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// Is reports whether err is a domain error of the given kind
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// Problem is the body of an error response, as per RFC 7807
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON reads the problem written by MarshalJSON, the members that aren't
+// standard go back to the extensions as json.RawMessage so that they are written the same
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+	standard := map[string]interface{}{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	}
+	for k, raw := range members {
+		if field, ok := standard[k]; ok {
+			if err := json.Unmarshal(raw, field); err != nil {
+				return fmt.Errorf("problem member %q: %w", k, err)
+			}
+			continue
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Extensions[k] = raw
+	}
+	return nil
+}
+
+// ProblemOf converts an error to the problem details sent to the client,
+// the detail of the errors outside of the domain is never disclosed
+func ProblemOf(err error) Problem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Kind: Internal, Detail: "An unexpected error occurred"}
+	}
+	status := e.Status
+	if status == 0 {
+		status = statuses[e.Kind]
+	}
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	return Problem{
+		Type:       typePrefix + string(e.Kind),
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     e.Detail,
+		Extensions: e.Extensions,
+	}
+}
+
+// Write sends an error as an application/problem+json response, the internal errors are logged
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	problem := ProblemOf(err)
+	problem.Instance = r.URL.Path
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,56 @@
+package apperror
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestProblemRoundTrip(t *testing.T) {
+	type fieldError struct {
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	err := New(Validation, "The company is not valid").With("errors", []fieldError{
+		{Field: "name", Code: "required", Message: "name is required"},
+		{Field: "employees", Code: "negative", Message: "employees must not be negative"},
+	})
+	problem := ProblemOf(err)
+	problem.Instance = "/jobs/1"
+
+	data, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		t.Fatalf("marshal: %v", marshalErr)
+	}
+	var got Problem
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if got.Type != problem.Type || got.Title != problem.Title || got.Status != http.StatusBadRequest ||
+		got.Detail != problem.Detail || got.Instance != problem.Instance {
+		t.Errorf("got %+v, want %+v", got, problem)
+	}
+	raw, ok := got.Extensions["errors"].(json.RawMessage)
+	if !ok {
+		t.Fatalf("got extensions %#v, want the errors member", got.Extensions)
+	}
+	var violations []fieldError
+	if err := json.Unmarshal(raw, &violations); err != nil {
+		t.Fatalf("unmarshal the errors: %v", err)
+	}
+	if !reflect.DeepEqual(violations, err.Extensions["errors"]) {
+		t.Errorf("got errors %+v, want %+v", violations, err.Extensions["errors"])
+	}
+
+	// the problem reads back the same
+	again, marshalErr := json.Marshal(got)
+	if marshalErr != nil {
+		t.Fatalf("marshal: %v", marshalErr)
+	}
+	if string(again) != string(data) {
+		t.Errorf("got %s after a round trip, want %s", again, data)
+	}
+}
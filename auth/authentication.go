@@ -1,94 +1,160 @@
 package auth
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
+	"time"
 
+	database "github.com/jain-chetan/companyservice/database"
 	models "github.com/jain-chetan/companyservice/model"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/joho/godotenv"
+	"github.com/google/uuid"
 )
 
-func Encrypt(pwd string) string {
-	h := sha1.New()
-	h.Write([]byte(pwd))
-	sha1_hash := hex.EncodeToString(h.Sum(nil))
-	return sha1_hash
+// TokenConfig has the settings of the issued tokens
+type TokenConfig struct {
+	Secret     string
+	Issuer     string
+	Audience   string
+	TTL        time.Duration
+	RefreshTTL time.Duration
 }
 
-func ValidateToken(req http.Header) (map[string]interface{}, error) {
+// Store keeps the users, their refresh tokens and the revoked tokens
+type Store interface {
+	database.UserStore
+	database.TokenStore
+}
+
+// ErrInvalidToken is returned for the tokens that can't be accepted
+var ErrInvalidToken = errors.New("invalid token")
 
-	token := req.Get("token")
+// Claims are the claims carried by a token, they identify the user without any credential
+type Claims struct {
+	Email string      `json:"email"`
+	Role  models.Role `json:"role"`
+	jwt.StandardClaims
+}
+
+// Authenticator creates and validates the tokens signed with the secret key
+type Authenticator struct {
+	secretKey  []byte
+	issuer     string
+	audience   string
+	ttl        time.Duration
+	refreshTTL time.Duration
+	store      Store
+}
+
+// NewAuthenticator creates an authenticator issuing tokens with the given settings
+func NewAuthenticator(cfg TokenConfig, store Store) *Authenticator {
+	return &Authenticator{
+		secretKey:  []byte(cfg.Secret),
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		ttl:        cfg.TTL,
+		refreshTTL: cfg.RefreshTTL,
+		store:      store,
+	}
+}
+
+// ValidateToken decrypts a token and checks that it identifies a user and hasn't been revoked,
+// the tokens that can't be accepted are reported as ErrInvalidToken
+func (a *Authenticator) ValidateToken(token string) (*Claims, error) {
 
 	//decrypt the token and get the jwt claims
-	mapClaims, tokenErr := DecryptToken(token)
+	claims, tokenErr := a.DecryptToken(token)
 	if tokenErr != nil {
-		return nil, tokenErr
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, tokenErr)
 	}
 
-	//Authenticate the token claims
-	if !(fmt.Sprintf("%v", mapClaims["email"]) == "abc@gmail.com" && fmt.Sprintf("%v", mapClaims["password"]) == "root") {
-		return nil, errors.New("user not authenticated")
+	//Authenticate the token claims, tokens are only issued to users whose password was verified
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
 	}
-	return mapClaims, nil
-}
 
-//Create token with user details and expiry token
-func CreateToken(user models.User) (string, error) {
-
-	secretKey, err := getSecretKey()
+	//Reject the tokens revoked before they expire, failing closed when the denylist can't be read
+	revoked, err := a.store.IsTokenRevokedQuery(claims.Id)
 	if err != nil {
-		log.Println(err)
-		return "", errors.New("Couldn't find secret key")
+		return nil, fmt.Errorf("unable to check the token revocation: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: token revoked", ErrInvalidToken)
 	}
+	return claims, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":    user.Email,
-		"password": user.Password,
-	})
+// CreateToken creates a token identifying the user and a refresh token starting a new family,
+// the password must have been verified first
+func (a *Authenticator) CreateToken(user models.User) (models.Token, error) {
+	return a.issue(user, uuid.New())
+}
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+// issue creates an access token and a refresh token of the given family
+func (a *Authenticator) issue(user models.User, familyID uuid.UUID) (models.Token, error) {
+
+	now := time.Now()
+	claims := Claims{
+		Email: user.Email,
+		Role:  user.Role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			Subject:   user.ID.String(),
+			Issuer:    a.issuer,
+			Audience:  a.audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(a.ttl).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, err := token.SignedString(a.secretKey)
 	if err != nil {
-		log.Println(err)
-		return "", err
+		return models.Token{}, err
 	}
-	return tokenString, nil
-}
 
-//Retreive secret key from env
-func getSecretKey() (string, error) {
-	err := godotenv.Load()
+	refreshToken, err := a.createRefreshToken(user, familyID, claims.Id)
 	if err != nil {
-		return "", err
+		return models.Token{}, err
 	}
-	return os.Getenv("TOKENSECRET"), nil
+	return models.Token{
+		AccessToken:  tokenString,
+		ExpiresIn:    int(a.ttl.Seconds()),
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+	}, nil
 }
 
-func DecryptToken(tokenString string) (map[string]interface{}, error) {
+// DecryptToken verifies the signature, the lifetime, the issuer and the audience of a token
+func (a *Authenticator) DecryptToken(tokenString string) (*Claims, error) {
 	if tokenString == "" {
-		return nil, errors.New("Token not provided")
+		return nil, errors.New("token not provided")
 	}
-	secretKey, err := getSecretKey()
-	if err != nil {
-		log.Println(err)
-		return nil, errors.New("Couldn't find secret key")
-	}
-	token, _ := jwt.Parse(string(tokenString), func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("There was an error")
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secretKey), nil
+		return a.secretKey, nil
 	})
-
-	if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		mapClaims := token.Claims.(jwt.MapClaims)
-		return mapClaims, nil
+	// the standard claims validation checks exp, iat and nbf
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return nil, errors.New("token expired")
+	}
+	if err != nil || !token.Valid {
+		return nil, errors.New("token malformed or not signed by this service")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiry")
+	}
+	if !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("token issuer not accepted")
+	}
+	if !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("token audience not accepted")
 	}
-	return nil, errors.New("Token error")
+	return claims, nil
 }
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+)
+
+// realm is the protection space advertised in WWW-Authenticate
+const realm = "companyservice"
+
+// ErrAuthenticationRequired is sent to the requests without a bearer token
+var ErrAuthenticationRequired = apperror.New(apperror.Unauthorized, "Authentication required")
+
+type contextKey struct{}
+
+// WithClaims returns a copy of the context carrying the claims of the authenticated user
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the authenticated user of a request
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// bearerToken extracts the token of an Authorization: Bearer <token> header
+func bearerToken(header http.Header) (string, bool) {
+	scheme, token, found := strings.Cut(header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Middleware authenticates the requests with the bearer token of their Authorization header
+// and places the claims of the user in the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header)
+		if !ok {
+			// a request without credentials gets the challenge alone, as per RFC 6750
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", realm))
+			apperror.Write(w, r, ErrAuthenticationRequired)
+			return
+		}
+
+		claims, err := a.ValidateToken(token)
+		if errors.Is(err, ErrInvalidToken) {
+			description := strings.TrimPrefix(err.Error(), ErrInvalidToken.Error()+": ")
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", realm, description))
+			apperror.Write(w, r, apperror.Wrap(apperror.Unauthorized, err, "Not a valid token: %s", description))
+			return
+		}
+		if err != nil {
+			apperror.Write(w, r, apperror.Wrap(apperror.Internal, err, "Unable to validate the token"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
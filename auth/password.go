@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"github.com/jain-chetan/companyservice/apperror"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted at registration
+const MinPasswordLength = 8
+
+// bcrypt ignores everything past 72 bytes, longer passwords are refused rather than truncated
+const maxPasswordLength = 72
+
+// ErrInvalidCredentials is returned when the email or the password of a login is wrong
+var ErrInvalidCredentials = apperror.New(apperror.Unauthorized, "Invalid email or password")
+
+// ErrInvalidPassword is returned for the passwords too short or too long to be accepted
+var ErrInvalidPassword = apperror.New(apperror.Validation, "password must be between 8 and 72 bytes long")
+
+// dummyHash is compared against when the user doesn't exist, so that
+// unknown emails take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("companyservice-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword returns the salted bcrypt hash of a password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > maxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", apperror.Wrap(apperror.Internal, err, "Unable to hash the password")
+	}
+	return string(hash), nil
+}
+
+// CheckPassword verifies a password against its hash, an empty hash stands for an unknown user
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken is returned for the refresh tokens that can't be exchanged
+var ErrInvalidRefreshToken = apperror.New(apperror.Unauthorized, "Invalid refresh token")
+
+// hashToken is what the store keeps of a refresh token, so that a leaked db doesn't leak usable tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createRefreshToken creates and stores a random refresh token issued along with an access token
+func (a *Authenticator) createRefreshToken(user models.User, familyID uuid.UUID, accessJTI string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	err := a.store.CreateRefreshTokenQuery(models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		AccessJTI: accessJTI,
+		ExpiresAt: time.Now().Add(a.refreshTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Every refresh token can be used once, presenting one again revokes its whole family
+// since either the client or an attacker holds a copy of it.
+func (a *Authenticator) Refresh(refreshToken string) (models.Token, error) {
+	if refreshToken == "" {
+		return models.Token{}, ErrInvalidRefreshToken
+	}
+
+	token, err := a.store.UseRefreshTokenQuery(hashToken(refreshToken))
+	if errors.Is(err, database.ErrTokenReused) {
+		if err := a.store.RevokeRefreshTokenFamilyQuery(token); err != nil {
+			return models.Token{}, err
+		}
+		return models.Token{}, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, database.ErrRefreshTokenNotFound) {
+		return models.Token{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	user, err := a.store.GetUserQuery(token.UserID)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return models.Token{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.Token{}, err
+	}
+	return a.issue(user, token.FamilyID)
+}
+
+// Logout revokes the access token of the claims, and with it the refresh token family
+// of the login it was issued to
+func (a *Authenticator) Logout(claims *Claims) error {
+	return a.store.RevokeTokenQuery(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// Revoke denies the access token with the given jti, whoever it was issued to,
+// along with the refresh tokens issued with it
+func (a *Authenticator) Revoke(jti string) error {
+	// the token can't outlive the configured lifetime from now on
+	return a.store.RevokeTokenQuery(jti, time.Now().Add(a.ttl))
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// newTestAuthenticator returns an authenticator on a memory store, a new user and a token of the user
+func newTestAuthenticator(t *testing.T, refreshTTL time.Duration) (*Authenticator, models.User, models.Token) {
+	t.Helper()
+	store := database.NewMemoryStore()
+	a := NewAuthenticator(TokenConfig{
+		Secret:     "test-secret",
+		Issuer:     "companyservice",
+		Audience:   "companyservice",
+		TTL:        time.Hour,
+		RefreshTTL: refreshTTL,
+	}, store)
+
+	user, err := store.CreateUserQuery(models.User{Email: "ann@example.com", Role: models.RoleEditor})
+	if err != nil {
+		t.Fatalf("create the user: %v", err)
+	}
+	token, err := a.CreateToken(user)
+	if err != nil {
+		t.Fatalf("create the token: %v", err)
+	}
+	return a, user, token
+}
+
+// authenticate sends a request with the access token through the middleware and returns the status
+func authenticate(a *Authenticator, accessToken string) int {
+	r := httptest.NewRequest(http.MethodGet, "/companies", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRefreshTokenWorksOnce(t *testing.T) {
+	a, _, token := newTestAuthenticator(t, time.Hour)
+
+	refreshed, err := a.Refresh(token.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == token.RefreshToken {
+		t.Errorf("got refresh token %q, want a new one", refreshed.RefreshToken)
+	}
+	if status := authenticate(a, refreshed.AccessToken); status != http.StatusNoContent {
+		t.Errorf("new access token: got status %d, want %d", status, http.StatusNoContent)
+	}
+
+	if _, err := a.Refresh(token.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("second refresh: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	for _, unknown := range []string{"", "not-a-refresh-token"} {
+		if _, err := a.Refresh(unknown); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refresh with %q: got %v, want %v", unknown, err, ErrInvalidRefreshToken)
+		}
+	}
+}
+
+func TestRefreshTokenReuseRevokesTheFamily(t *testing.T) {
+	a, user, token := newTestAuthenticator(t, time.Hour)
+
+	// the client rotates twice, then the first token comes back from whoever copied it
+	second, err := a.Refresh(token.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	third, err := a.Refresh(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := a.Refresh(token.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reuse: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	// the latest token of the family is revoked along with the others
+	if _, err := a.Refresh(third.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh with the latest token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	// the other logins of the user are left alone
+	other, err := a.CreateToken(user)
+	if err != nil {
+		t.Fatalf("create the token: %v", err)
+	}
+	if _, err := a.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("refresh of another login: %v", err)
+	}
+}
+
+func TestRevokedAccessTokenIsRejected(t *testing.T) {
+	a, user, token := newTestAuthenticator(t, time.Hour)
+	if status := authenticate(a, token.AccessToken); status != http.StatusNoContent {
+		t.Fatalf("before the revocation: got status %d, want %d", status, http.StatusNoContent)
+	}
+
+	claims, err := a.ValidateToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := a.Revoke(claims.Id); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if status := authenticate(a, token.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("after the revocation: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	// the refresh token issued with it goes too
+	if _, err := a.Refresh(token.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	// logging out revokes the token of the request the same way
+	token, err = a.CreateToken(user)
+	if err != nil {
+		t.Fatalf("create the token: %v", err)
+	}
+	claims, err = a.ValidateToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := a.Logout(claims); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if status := authenticate(a, token.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("after the logout: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestExpiredRefreshTokenIsRejected(t *testing.T) {
+	a, _, token := newTestAuthenticator(t, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := a.Refresh(token.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Permission is an operation a route requires the user to be allowed
+type Permission string
+
+const (
+	ReadCompanies   Permission = "companies:read"
+	WriteCompanies  Permission = "companies:write"
+	DeleteCompanies Permission = "companies:delete"
+	// ReadDeletedCompanies lists the deleted companies, DeleteCompanies restores them
+	ReadDeletedCompanies Permission = "companies:read_deleted"
+	ReadAudit            Permission = "audit:read"
+	RevokeTokens         Permission = "tokens:revoke"
+	ManageUsers          Permission = "users:manage"
+	ManageWebhooks       Permission = "webhooks:manage"
+	// ManageJobs reads and cancels the jobs of the other users, everyone manages their own
+	ManageJobs Permission = "jobs:manage"
+)
+
+// rolePermissions lists what every role is allowed, each role includes the one below it
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleViewer: {ReadCompanies},
+	models.RoleEditor: {ReadCompanies, WriteCompanies},
+	models.RoleAdmin:  {ReadCompanies, WriteCompanies, DeleteCompanies, ReadDeletedCompanies, ReadAudit, RevokeTokens, ManageUsers, ManageWebhooks, ManageJobs},
+}
+
+// ValidRole reports whether a role is one of the known roles
+func ValidRole(role models.Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Allowed reports whether a role grants a permission
+func Allowed(role models.Role, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns a middleware refusing with 403 the requests whose user lacks the permission,
+// it must run after Middleware which places the claims in the context
+func Require(permission Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := Check(w, r, permission); err != nil {
+				apperror.Write(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Check returns the error to send when the user of a request lacks a permission, for the
+// handlers whose permission depends on the request. The WWW-Authenticate challenge is set on w.
+func Check(w http.ResponseWriter, r *http.Request, permission Permission) error {
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		return ErrAuthenticationRequired
+	}
+	if !Allowed(claims.Role, permission) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"insufficient_scope\", scope=%q", realm, permission))
+		return apperror.New(apperror.Forbidden, "Role %q is not allowed %s", claims.Role, permission).
+			With("reason", "insufficient_role").
+			With("permission", permission).
+			With("role", claims.Role)
+	}
+	return nil
+}
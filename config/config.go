@@ -0,0 +1,557 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config has everything the service needs to start
+type Config struct {
+	ListenAddr    string
+	Store         string
+	DB            models.DBConfig
+	AutoMigrate   bool
+	TokenSecret   string
+	TokenIssuer   string
+	TokenAudience string
+	TokenTTL      time.Duration
+	RefreshTTL    time.Duration
+	AdminEmails   []string
+	LogLevel      string
+	// DeletedRetention is how long the deleted companies can be restored before they are purged
+	DeletedRetention time.Duration
+	PurgeInterval    time.Duration
+	// EventSink is where the relay publishes the events of the outbox: log or http
+	EventSink          string
+	EventHTTPURL       string
+	EventRelayInterval time.Duration
+	EventBatchSize     int
+	// EventMaxAttempts is the number of attempts to publish an event before it is parked,
+	// EventBackoff the delay before the second one, doubled up to EventMaxBackoff
+	EventMaxAttempts int
+	EventBackoff     time.Duration
+	EventMaxBackoff  time.Duration
+	// WebhookMaxAttempts is the number of attempts of a delivery before it is dead,
+	// WebhookBackoff the delay before the second one, doubled up to WebhookMaxBackoff
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	WebhookMaxBackoff  time.Duration
+	WebhookTimeout     time.Duration
+	WebhookInterval    time.Duration
+	// JobWorkers is the number of jobs run at once, a job not saving its progress
+	// within JobLease is taken over by another worker, up to JobMaxAttempts times
+	JobWorkers       int
+	JobInterval      time.Duration
+	JobLease         time.Duration
+	JobMaxAttempts   int
+	JobMaxInputBytes int
+	// Server has the timeouts of the http server listening on ListenAddr
+	Server ServerConfig
+}
+
+// ServerConfig has the timeouts of the http server, ShutdownTimeout is how long the
+// requests in flight and the workers are given to finish on shutdown
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() Config {
+	return Config{
+		ListenAddr: ":8080",
+		Store:      "postgres",
+		DB: models.DBConfig{
+			Host:            "localhost",
+			User:            "postgres",
+			Password:        "postgres",
+			DBName:          "testdb",
+			Port:            "5432",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		AutoMigrate:   true,
+		TokenIssuer:   "companyservice",
+		TokenAudience: "companyservice",
+		TokenTTL:      15 * time.Minute,
+		RefreshTTL:    30 * 24 * time.Hour,
+		LogLevel:      "info",
+
+		DeletedRetention: 30 * 24 * time.Hour,
+		PurgeInterval:    time.Hour,
+
+		EventSink:          "log",
+		EventRelayInterval: time.Second,
+		EventBatchSize:     100,
+		EventMaxAttempts:   10,
+		EventBackoff:       5 * time.Second,
+		EventMaxBackoff:    10 * time.Minute,
+
+		WebhookMaxAttempts: 10,
+		WebhookBackoff:     10 * time.Second,
+		WebhookMaxBackoff:  time.Hour,
+		WebhookTimeout:     10 * time.Second,
+		WebhookInterval:    time.Second,
+
+		JobWorkers:       2,
+		JobInterval:      time.Second,
+		JobLease:         time.Minute,
+		JobMaxAttempts:   5,
+		JobMaxInputBytes: 64 << 20,
+
+		Server: ServerConfig{
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+	}
+}
+
+// setting is one configuration value with its name in every source
+type setting struct {
+	key   string // key in the config file, nested keys are separated by dots
+	env   string
+	flag  string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+func stringSetting(key, env, flag, usage string, field func(c *Config) *string) setting {
+	return setting{key, env, flag, usage, func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(key, env, flag, usage string, field func(c *Config) *int) setting {
+	return setting{key, env, flag, usage, func(c *Config, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func boolSetting(key, env, flag, usage string, field func(c *Config) *bool) setting {
+	return setting{key, env, flag, usage, func(c *Config, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func listSetting(key, env, flag, usage string, field func(c *Config) *[]string) setting {
+	return setting{key, env, flag, usage, func(c *Config, value string) error {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*field(c) = values
+		return nil
+	}}
+}
+
+func durationSetting(key, env, flag, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{key, env, flag, usage, func(c *Config, value string) error {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 15m", value)
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("listen_addr", "LISTEN_ADDR", "listen-addr", "address the http server listens on",
+		func(c *Config) *string { return &c.ListenAddr }),
+	durationSetting("server.read_header_timeout", "SERVER_READ_HEADER_TIMEOUT", "server-read-header-timeout", "time allowed to read the headers of a request",
+		func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout }),
+	durationSetting("server.read_timeout", "SERVER_READ_TIMEOUT", "server-read-timeout", "time allowed to read a whole request, body included",
+		func(c *Config) *time.Duration { return &c.Server.ReadTimeout }),
+	durationSetting("server.write_timeout", "SERVER_WRITE_TIMEOUT", "server-write-timeout", "time allowed to write a response, from the end of the request headers",
+		func(c *Config) *time.Duration { return &c.Server.WriteTimeout }),
+	durationSetting("server.idle_timeout", "SERVER_IDLE_TIMEOUT", "server-idle-timeout", "how long an idle keep-alive connection is kept open",
+		func(c *Config) *time.Duration { return &c.Server.IdleTimeout }),
+	durationSetting("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", "server-shutdown-timeout", "time given to the requests in flight and the workers to finish on shutdown",
+		func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout }),
+	stringSetting("store", "STORE", "store", "company store to use: postgres or memory",
+		func(c *Config) *string { return &c.Store }),
+	stringSetting("db.host", "DB_HOST", "db-host", "postgres host",
+		func(c *Config) *string { return &c.DB.Host }),
+	stringSetting("db.port", "DB_PORT", "db-port", "postgres port",
+		func(c *Config) *string { return &c.DB.Port }),
+	stringSetting("db.user", "DB_USER", "db-user", "postgres user",
+		func(c *Config) *string { return &c.DB.User }),
+	stringSetting("db.password", "DB_PASSWORD", "db-password", "postgres password",
+		func(c *Config) *string { return &c.DB.Password }),
+	stringSetting("db.name", "DB_NAME", "db-name", "postgres database name",
+		func(c *Config) *string { return &c.DB.DBName }),
+	stringSetting("db.sslmode", "DB_SSLMODE", "db-sslmode", "postgres sslmode",
+		func(c *Config) *string { return &c.DB.SSLMode }),
+	intSetting("db.max_open_conns", "DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum number of open connections to the db",
+		func(c *Config) *int { return &c.DB.MaxOpenConns }),
+	intSetting("db.max_idle_conns", "DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum number of idle connections to the db",
+		func(c *Config) *int { return &c.DB.MaxIdleConns }),
+	durationSetting("db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum amount of time a connection to the db may be reused",
+		func(c *Config) *time.Duration { return &c.DB.ConnMaxLifetime }),
+	boolSetting("auto_migrate", "AUTO_MIGRATE", "auto-migrate", "apply the pending schema migrations at startup",
+		func(c *Config) *bool { return &c.AutoMigrate }),
+	stringSetting("token.secret", "TOKENSECRET", "token-secret", "secret used to sign the tokens",
+		func(c *Config) *string { return &c.TokenSecret }),
+	stringSetting("token.issuer", "TOKEN_ISSUER", "token-issuer", "issuer (iss) of the tokens",
+		func(c *Config) *string { return &c.TokenIssuer }),
+	stringSetting("token.audience", "TOKEN_AUDIENCE", "token-audience", "audience (aud) of the tokens",
+		func(c *Config) *string { return &c.TokenAudience }),
+	durationSetting("token.ttl", "TOKEN_TTL", "token-ttl", "lifetime of the tokens",
+		func(c *Config) *time.Duration { return &c.TokenTTL }),
+	durationSetting("token.refresh_ttl", "REFRESH_TOKEN_TTL", "refresh-token-ttl", "lifetime of the refresh tokens",
+		func(c *Config) *time.Duration { return &c.RefreshTTL }),
+	listSetting("admin_emails", "ADMIN_EMAILS", "admin-emails", "comma-separated emails of the users given the admin role when they register",
+		func(c *Config) *[]string { return &c.AdminEmails }),
+	stringSetting("log_level", "LOG_LEVEL", "log-level", "minimum level of the logs: debug, info, warn or error",
+		func(c *Config) *string { return &c.LogLevel }),
+	durationSetting("deleted_retention", "DELETED_RETENTION", "deleted-retention", "how long the deleted companies can be restored before they are purged",
+		func(c *Config) *time.Duration { return &c.DeletedRetention }),
+	durationSetting("purge_interval", "PURGE_INTERVAL", "purge-interval", "how often the companies deleted for longer than the retention are purged",
+		func(c *Config) *time.Duration { return &c.PurgeInterval }),
+	stringSetting("events.sink", "EVENT_SINK", "event-sink", "where the events of the company changes are published: log or http",
+		func(c *Config) *string { return &c.EventSink }),
+	stringSetting("events.http_url", "EVENT_HTTP_URL", "event-http-url", "url the events are posted to by the http sink",
+		func(c *Config) *string { return &c.EventHTTPURL }),
+	durationSetting("events.relay_interval", "EVENT_RELAY_INTERVAL", "event-relay-interval", "how often the pending events of the outbox are published",
+		func(c *Config) *time.Duration { return &c.EventRelayInterval }),
+	intSetting("events.batch_size", "EVENT_BATCH_SIZE", "event-batch-size", "number of events claimed by the relay at a time",
+		func(c *Config) *int { return &c.EventBatchSize }),
+	intSetting("events.max_attempts", "EVENT_MAX_ATTEMPTS", "event-max-attempts", "number of attempts to publish an event before it is parked",
+		func(c *Config) *int { return &c.EventMaxAttempts }),
+	durationSetting("events.backoff", "EVENT_BACKOFF", "event-backoff", "delay before the second attempt to publish an event, doubled for every next one",
+		func(c *Config) *time.Duration { return &c.EventBackoff }),
+	durationSetting("events.max_backoff", "EVENT_MAX_BACKOFF", "event-max-backoff", "maximum delay between the attempts to publish an event",
+		func(c *Config) *time.Duration { return &c.EventMaxBackoff }),
+	intSetting("webhooks.max_attempts", "WEBHOOK_MAX_ATTEMPTS", "webhook-max-attempts", "number of attempts of a webhook delivery before it is dead",
+		func(c *Config) *int { return &c.WebhookMaxAttempts }),
+	durationSetting("webhooks.backoff", "WEBHOOK_BACKOFF", "webhook-backoff", "delay before the second attempt of a webhook delivery, doubled for every next one",
+		func(c *Config) *time.Duration { return &c.WebhookBackoff }),
+	durationSetting("webhooks.max_backoff", "WEBHOOK_MAX_BACKOFF", "webhook-max-backoff", "maximum delay between the attempts of a webhook delivery",
+		func(c *Config) *time.Duration { return &c.WebhookMaxBackoff }),
+	durationSetting("webhooks.timeout", "WEBHOOK_TIMEOUT", "webhook-timeout", "timeout of the requests to the webhooks",
+		func(c *Config) *time.Duration { return &c.WebhookTimeout }),
+	durationSetting("webhooks.interval", "WEBHOOK_INTERVAL", "webhook-interval", "how often the webhook deliveries due are sent",
+		func(c *Config) *time.Duration { return &c.WebhookInterval }),
+	intSetting("jobs.workers", "JOB_WORKERS", "job-workers", "number of background jobs run at once",
+		func(c *Config) *int { return &c.JobWorkers }),
+	durationSetting("jobs.interval", "JOB_INTERVAL", "job-interval", "how often the workers look for a job to run",
+		func(c *Config) *time.Duration { return &c.JobInterval }),
+	durationSetting("jobs.lease", "JOB_LEASE", "job-lease", "how long a job is left to its worker without progress before another resumes it",
+		func(c *Config) *time.Duration { return &c.JobLease }),
+	intSetting("jobs.max_attempts", "JOB_MAX_ATTEMPTS", "job-max-attempts", "number of workers a job may lose before it fails",
+		func(c *Config) *int { return &c.JobMaxAttempts }),
+	intSetting("jobs.max_input_bytes", "JOB_MAX_INPUT_BYTES", "job-max-input-bytes", "maximum size of the file of an import job",
+		func(c *Config) *int { return &c.JobMaxInputBytes }),
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, the config file, the environment and the command-line flags.
+// The arguments left after the flags are returned with it.
+func Load(name string, args []string) (Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path of a YAML or JSON config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.flag] = flags.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	// the variables of a .env file never override the environment
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil, fmt.Errorf("unable to read .env: %w", err)
+	}
+
+	var problems Errors
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				problems.add(s.key, "config file", s.apply(&cfg, v))
+				delete(values, s.key)
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting in config file %s", key, *configFile))
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			problems.add(s.env, "environment", s.apply(&cfg, v))
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				problems.add("-"+s.flag, "flag", s.apply(&cfg, *flagValues[s.flag]))
+			}
+		}
+	})
+
+	if len(problems) > 0 {
+		return cfg, nil, problems
+	}
+	return cfg, flags.Args(), cfg.Validate()
+}
+
+// readFile reads a YAML or JSON config file into a map of dotted keys
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+	return values, nil
+}
+
+func flatten(prefix string, raw map[string]interface{}, values map[string]string) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(key, nested, values)
+			continue
+		}
+		if list, ok := v.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+			continue
+		}
+		values[key] = fmt.Sprint(v)
+	}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// Validate checks that the configuration can be used to start the service
+func (c Config) Validate() error {
+	var problems Errors
+
+	if _, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("listen_addr: %q is not a host:port address", c.ListenAddr))
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		problems = append(problems, fmt.Sprintf("listen_addr: %q is not a valid port", port))
+	}
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			problems = append(problems, timeout.key+": must be positive")
+		}
+	}
+
+	switch c.Store {
+	case "memory":
+	case "postgres":
+		if c.DB.Host == "" {
+			problems = append(problems, "db.host: is required")
+		}
+		if n, err := strconv.Atoi(c.DB.Port); err != nil || n < 1 || n > 65535 {
+			problems = append(problems, fmt.Sprintf("db.port: %q is not a port between 1 and 65535", c.DB.Port))
+		}
+		if c.DB.User == "" {
+			problems = append(problems, "db.user: is required")
+		}
+		if c.DB.DBName == "" {
+			problems = append(problems, "db.name: is required")
+		}
+		if !sslModes[c.DB.SSLMode] {
+			problems = append(problems, fmt.Sprintf("db.sslmode: %q is not one of disable, allow, prefer, require, verify-ca or verify-full", c.DB.SSLMode))
+		}
+		if c.DB.MaxOpenConns < 0 {
+			problems = append(problems, "db.max_open_conns: must not be negative")
+		}
+		if c.DB.MaxIdleConns < 0 {
+			problems = append(problems, "db.max_idle_conns: must not be negative")
+		}
+		if c.DB.ConnMaxLifetime < 0 {
+			problems = append(problems, "db.conn_max_lifetime: must not be negative")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("store: %q is not one of postgres or memory", c.Store))
+	}
+
+	if c.TokenSecret == "" {
+		problems = append(problems, "token.secret: is required, set TOKENSECRET")
+	}
+	if c.TokenIssuer == "" {
+		problems = append(problems, "token.issuer: is required")
+	}
+	if c.TokenAudience == "" {
+		problems = append(problems, "token.audience: is required")
+	}
+	if c.TokenTTL <= 0 {
+		problems = append(problems, "token.ttl: must be positive")
+	}
+	if c.RefreshTTL <= 0 {
+		problems = append(problems, "token.refresh_ttl: must be positive")
+	}
+	if c.DeletedRetention < 0 {
+		problems = append(problems, "deleted_retention: must not be negative")
+	}
+	if c.PurgeInterval <= 0 {
+		problems = append(problems, "purge_interval: must be positive")
+	}
+	switch c.EventSink {
+	case "log":
+	case "http":
+		if u, err := url.Parse(c.EventHTTPURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("events.http_url: %q is not an http or https url", c.EventHTTPURL))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("events.sink: %q is not one of log or http", c.EventSink))
+	}
+	if c.EventRelayInterval <= 0 {
+		problems = append(problems, "events.relay_interval: must be positive")
+	}
+	if c.EventBatchSize <= 0 {
+		problems = append(problems, "events.batch_size: must be positive")
+	}
+	if c.EventMaxAttempts <= 0 {
+		problems = append(problems, "events.max_attempts: must be positive")
+	}
+	if c.EventBackoff <= 0 {
+		problems = append(problems, "events.backoff: must be positive")
+	}
+	if c.EventMaxBackoff < c.EventBackoff {
+		problems = append(problems, "events.max_backoff: must not be less than events.backoff")
+	}
+	if c.WebhookMaxAttempts <= 0 {
+		problems = append(problems, "webhooks.max_attempts: must be positive")
+	}
+	if c.WebhookBackoff <= 0 {
+		problems = append(problems, "webhooks.backoff: must be positive")
+	}
+	if c.WebhookMaxBackoff < c.WebhookBackoff {
+		problems = append(problems, "webhooks.max_backoff: must not be less than webhooks.backoff")
+	}
+	if c.WebhookTimeout <= 0 {
+		problems = append(problems, "webhooks.timeout: must be positive")
+	}
+	if c.WebhookInterval <= 0 {
+		problems = append(problems, "webhooks.interval: must be positive")
+	}
+	if c.JobWorkers <= 0 {
+		problems = append(problems, "jobs.workers: must be positive")
+	}
+	if c.JobInterval <= 0 {
+		problems = append(problems, "jobs.interval: must be positive")
+	}
+	if c.JobLease <= 0 {
+		problems = append(problems, "jobs.lease: must be positive")
+	}
+	if c.JobMaxAttempts <= 0 {
+		problems = append(problems, "jobs.max_attempts: must be positive")
+	}
+	if c.JobMaxInputBytes <= 0 {
+		problems = append(problems, "jobs.max_input_bytes: must be positive")
+	}
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, "log_level: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Errors lists every problem found in the configuration
+type Errors []string
+
+func (e *Errors) add(name, source string, err error) {
+	if err != nil {
+		*e = append(*e, fmt.Sprintf("%s (%s): %v", name, source, err))
+	}
+}
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the variables of every setting for the test, they are restored after it
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range append([]string{"CONFIG_FILE"}, settingEnvs()...) {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+}
+
+func settingEnvs() []string {
+	envs := make([]string, len(settings))
+	for i, s := range settings {
+		envs[i] = s.env
+	}
+	return envs
+}
+
+// writeFile writes a config file in a directory of the test and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write the config file: %v", err)
+	}
+	return path
+}
+
+// problems returns the problems of an error returned by Load or Validate
+func problems(t *testing.T, err error) Errors {
+	t.Helper()
+	var list Errors
+	if err != nil && !errors.As(err, &list) {
+		t.Fatalf("got the error %v, want the problems of the configuration", err)
+	}
+	return list
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	// every layer sets listen_addr to its own port, the highest one present wins
+	tests := []struct {
+		name            string
+		file, env, flag bool
+		want            string
+	}{
+		{"defaults", false, false, false, ":8080"},
+		{"file over defaults", true, false, false, ":8081"},
+		{"environment over defaults", false, true, false, ":8082"},
+		{"environment over file", true, true, false, ":8082"},
+		{"flag over defaults", false, false, true, ":8083"},
+		{"flag over file", true, false, true, ":8083"},
+		{"flag over environment", false, true, true, ":8083"},
+		{"flag over everything", true, true, true, ":8083"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("TOKENSECRET", "secret")
+			var args []string
+			if test.file {
+				args = append(args, "-config", writeFile(t, "config.yaml", "listen_addr: \":8081\"\n"))
+			}
+			if test.env {
+				t.Setenv("LISTEN_ADDR", ":8082")
+			}
+			if test.flag {
+				args = append(args, "-listen-addr", ":8083")
+			}
+
+			cfg, rest, err := Load("test", append(args, "migrate", "up"))
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if cfg.ListenAddr != test.want {
+				t.Errorf("got listen_addr %q, want %q", cfg.ListenAddr, test.want)
+			}
+			if !reflect.DeepEqual(rest, []string{"migrate", "up"}) {
+				t.Errorf("got the arguments %v, want migrate up", rest)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "db:\n  host: db.internal\n  max_open_conns: 50\nserver:\n  write_timeout: 90s\nadmin_emails:\n  - ann@example.com\n  - bob@example.com\nauto_migrate: false\n",
+		"config.json": `{"db": {"host": "db.internal", "max_open_conns": 50}, "server": {"write_timeout": "90s"},
+			"admin_emails": ["ann@example.com", "bob@example.com"], "auto_migrate": false}`,
+	}
+	for name, content := range files {
+		clearEnv(t)
+		t.Setenv("TOKENSECRET", "secret")
+		// the file sets the nested keys and leaves the other settings to the defaults
+		t.Setenv("CONFIG_FILE", writeFile(t, name, content))
+		cfg, _, err := Load("test", nil)
+		if err != nil {
+			t.Fatalf("%s: load: %v", name, err)
+		}
+		want := Default()
+		want.TokenSecret = "secret"
+		want.DB.Host = "db.internal"
+		want.DB.MaxOpenConns = 50
+		want.Server.WriteTimeout = 90 * time.Second
+		want.AdminEmails = []string{"ann@example.com", "bob@example.com"}
+		want.AutoMigrate = false
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: got %+v, want %+v", name, cfg, want)
+		}
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want Errors
+	}{
+		{
+			name: "unknown keys of the file",
+			file: "listen_adr: \":8081\"\ndb:\n  hots: db.internal\n  host: db.internal\n",
+			want: Errors{"db.hots: unknown setting in config file %s", "listen_adr: unknown setting in config file %s"},
+		},
+		{
+			name: "values of the file",
+			file: "db:\n  max_open_conns: many\ntoken:\n  ttl: 15\n",
+			want: Errors{`db.max_open_conns (config file): "many" is not a number`, `token.ttl (config file): "15" is not a duration such as 30s or 15m`},
+		},
+		{
+			name: "values of the environment",
+			env:  map[string]string{"AUTO_MIGRATE": "sometimes", "JOB_WORKERS": "two"},
+			want: Errors{`AUTO_MIGRATE (environment): "sometimes" is not true or false`, `JOB_WORKERS (environment): "two" is not a number`},
+		},
+		{
+			name: "values of the flags",
+			args: []string{"-webhook-timeout", "10"},
+			want: Errors{`-webhook-timeout (flag): "10" is not a duration such as 30s or 15m`},
+		},
+		{
+			// the problems of every layer are reported at once, Validate is left for after them
+			name: "every layer",
+			file: "events:\n  batch_size: lots\n",
+			env:  map[string]string{"TOKENSECRET": "", "REFRESH_TOKEN_TTL": "forever"},
+			args: []string{"-event-backoff", "soon"},
+			want: Errors{
+				`events.batch_size (config file): "lots" is not a number`,
+				`REFRESH_TOKEN_TTL (environment): "forever" is not a duration such as 30s or 15m`,
+				`-event-backoff (flag): "soon" is not a duration such as 30s or 15m`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("TOKENSECRET", "secret")
+			for env, value := range test.env {
+				t.Setenv(env, value)
+			}
+			args := test.args
+			path := ""
+			if test.file != "" {
+				path = writeFile(t, "config.yaml", test.file)
+				args = append([]string{"-config", path}, args...)
+			}
+
+			_, _, err := Load("test", args)
+			got := problems(t, err)
+			want := make(Errors, len(test.want))
+			for i, problem := range test.want {
+				want[i] = strings.Replace(problem, "%s", path, 1)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got the problems %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	clearEnv(t)
+	_, _, err := Load("test", []string{"-store", "memory"})
+	if got := problems(t, err); !reflect.DeepEqual(got, Errors{"token.secret: is required, set TOKENSECRET"}) {
+		t.Errorf("got the problems %q, want the missing token secret", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		change func(c *Config)
+		want   string
+	}{
+		{func(c *Config) { c.ListenAddr = "8080" }, `listen_addr: "8080" is not a host:port address`},
+		{func(c *Config) { c.ListenAddr = ":http-alt" }, `listen_addr: "http-alt" is not a valid port`},
+		{func(c *Config) { c.ListenAddr = ":70000" }, `listen_addr: "70000" is not a valid port`},
+		{func(c *Config) { c.Server.ReadHeaderTimeout = 0 }, "server.read_header_timeout: must be positive"},
+		{func(c *Config) { c.Server.ReadTimeout = -time.Second }, "server.read_timeout: must be positive"},
+		{func(c *Config) { c.Server.WriteTimeout = 0 }, "server.write_timeout: must be positive"},
+		{func(c *Config) { c.Server.IdleTimeout = 0 }, "server.idle_timeout: must be positive"},
+		{func(c *Config) { c.Server.ShutdownTimeout = 0 }, "server.shutdown_timeout: must be positive"},
+		{func(c *Config) { c.Store = "redis" }, `store: "redis" is not one of postgres or memory`},
+		{func(c *Config) { c.DB.Host = "" }, "db.host: is required"},
+		{func(c *Config) { c.DB.Port = "postgres" }, `db.port: "postgres" is not a port between 1 and 65535`},
+		{func(c *Config) { c.DB.Port = "0" }, `db.port: "0" is not a port between 1 and 65535`},
+		{func(c *Config) { c.DB.Port = "65536" }, `db.port: "65536" is not a port between 1 and 65535`},
+		{func(c *Config) { c.DB.User = "" }, "db.user: is required"},
+		{func(c *Config) { c.DB.DBName = "" }, "db.name: is required"},
+		{func(c *Config) { c.DB.SSLMode = "on" }, `db.sslmode: "on" is not one of disable, allow, prefer, require, verify-ca or verify-full`},
+		{func(c *Config) { c.DB.MaxOpenConns = -1 }, "db.max_open_conns: must not be negative"},
+		{func(c *Config) { c.DB.MaxIdleConns = -1 }, "db.max_idle_conns: must not be negative"},
+		{func(c *Config) { c.DB.ConnMaxLifetime = -time.Second }, "db.conn_max_lifetime: must not be negative"},
+		{func(c *Config) { c.TokenSecret = "" }, "token.secret: is required, set TOKENSECRET"},
+		{func(c *Config) { c.TokenIssuer = "" }, "token.issuer: is required"},
+		{func(c *Config) { c.TokenAudience = "" }, "token.audience: is required"},
+		{func(c *Config) { c.TokenTTL = 0 }, "token.ttl: must be positive"},
+		{func(c *Config) { c.RefreshTTL = 0 }, "token.refresh_ttl: must be positive"},
+		{func(c *Config) { c.DeletedRetention = -time.Hour }, "deleted_retention: must not be negative"},
+		{func(c *Config) { c.PurgeInterval = 0 }, "purge_interval: must be positive"},
+		{func(c *Config) { c.EventSink = "kafka" }, `events.sink: "kafka" is not one of log or http`},
+		{func(c *Config) { c.EventSink = "http" }, `events.http_url: "" is not an http or https url`},
+		{func(c *Config) { c.EventSink, c.EventHTTPURL = "http", "ftp://events.internal" }, `events.http_url: "ftp://events.internal" is not an http or https url`},
+		{func(c *Config) { c.EventRelayInterval = 0 }, "events.relay_interval: must be positive"},
+		{func(c *Config) { c.EventBatchSize = 0 }, "events.batch_size: must be positive"},
+		{func(c *Config) { c.EventMaxAttempts = 0 }, "events.max_attempts: must be positive"},
+		{func(c *Config) { c.EventBackoff, c.EventMaxBackoff = 0, 0 }, "events.backoff: must be positive"},
+		{func(c *Config) { c.EventMaxBackoff = time.Second }, "events.max_backoff: must not be less than events.backoff"},
+		{func(c *Config) { c.WebhookMaxAttempts = 0 }, "webhooks.max_attempts: must be positive"},
+		{func(c *Config) { c.WebhookBackoff, c.WebhookMaxBackoff = 0, 0 }, "webhooks.backoff: must be positive"},
+		{func(c *Config) { c.WebhookMaxBackoff = time.Second }, "webhooks.max_backoff: must not be less than webhooks.backoff"},
+		{func(c *Config) { c.WebhookTimeout = 0 }, "webhooks.timeout: must be positive"},
+		{func(c *Config) { c.WebhookInterval = 0 }, "webhooks.interval: must be positive"},
+		{func(c *Config) { c.JobWorkers = 0 }, "jobs.workers: must be positive"},
+		{func(c *Config) { c.JobInterval = 0 }, "jobs.interval: must be positive"},
+		{func(c *Config) { c.JobLease = 0 }, "jobs.lease: must be positive"},
+		{func(c *Config) { c.JobMaxAttempts = 0 }, "jobs.max_attempts: must be positive"},
+		{func(c *Config) { c.JobMaxInputBytes = 0 }, "jobs.max_input_bytes: must be positive"},
+	}
+
+	valid := Default()
+	valid.TokenSecret = "secret"
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("the defaults with a secret: %v", err)
+	}
+	for _, test := range tests {
+		cfg := Default()
+		cfg.TokenSecret = "secret"
+		test.change(&cfg)
+		if got := problems(t, cfg.Validate()); !reflect.DeepEqual(got, Errors{test.want}) {
+			t.Errorf("%s: got the problems %q", test.want, got)
+		}
+	}
+
+	// the db settings are only checked for the postgres store
+	cfg := Default()
+	cfg.TokenSecret = "secret"
+	cfg.Store, cfg.DB.Host, cfg.DB.Port = "memory", "", ""
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("memory store without a db: %v", err)
+	}
+
+	// a bad log level is reported with the error of the logger
+	cfg.LogLevel = "loud"
+	if got := problems(t, cfg.Validate()); len(got) != 1 || !strings.HasPrefix(got[0], "log_level: ") {
+		t.Errorf("log level: got the problems %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// AuditStore reads the audit log, it is written by the changes of the CompanyStore
+type AuditStore interface {
+	ListAuditQuery(filter models.AuditFilter) ([]models.AuditEntry, string, error)
+}
+
+// auditCursor returns the id the next page of the audit log starts before
+func auditCursor(filter models.AuditFilter) (int64, error) {
+	if filter.Cursor == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(filter.Cursor, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// auditLimit returns the page size of a list of the audit log, with its default applied
+func auditLimit(filter models.AuditFilter) int {
+	switch {
+	case filter.Limit <= 0:
+		return DefaultListLimit
+	case filter.Limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return filter.Limit
+}
+
+// recordChange appends a change of a company to the audit log and its event to the outbox,
+// in the transaction of the change
+func recordChange(tx *sql.Tx, actor models.Actor, action models.AuditAction, before, after *models.Company) error {
+	changed := before
+	if changed == nil {
+		changed = after
+	}
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `INSERT INTO audit_log (company_id, action, subject, request_id, before, after) VALUES ($1, $2, $3, $4, $5, $6)`
+
+	// execute the sql statement
+	_, err = tx.Exec(sqlStatement, changed.ID, action, actor.Subject, actor.RequestID, beforeJSON, afterJSON)
+	if err != nil {
+		return queryError(err, nil)
+	}
+	return writeEvent(tx, newEvent(actor, action, before, after))
+}
+
+// snapshot encodes a company for the audit log, nil stays NULL
+func snapshot(company *models.Company) (interface{}, error) {
+	if company == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(company)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.Internal, err, "Unable to encode the company")
+	}
+	return string(b), nil
+}
+
+// list the audit entries matching the filter, newest first, one page at a time
+func (s *PostgresStore) ListAuditQuery(filter models.AuditFilter) ([]models.AuditEntry, string, error) {
+	before, err := auditCursor(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := auditLimit(filter)
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.CompanyID != nil {
+		addCondition("company_id = %s", *filter.CompanyID)
+	}
+	if filter.Subject != "" {
+		addCondition("subject = %s", filter.Subject)
+	}
+	if filter.Action != "" {
+		addCondition("action = %s", filter.Action)
+	}
+	if filter.Since != nil {
+		addCondition("created_at >= %s", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCondition("created_at < %s", *filter.Until)
+	}
+	if before != 0 {
+		addCondition("id < %s", before)
+	}
+
+	sqlStatement := `SELECT id, company_id, action, subject, request_id, before, after, created_at FROM audit_log`
+	if len(conditions) > 0 {
+		sqlStatement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// fetch one extra row to know whether there is a next page
+	args = append(args, limit+1)
+	sqlStatement += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, "", queryError(err, nil)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var beforeJSON, afterJSON []byte
+		err := rows.Scan(&entry.ID, &entry.CompanyID, &entry.Action, &entry.Subject, &entry.RequestID, &beforeJSON, &afterJSON, &entry.CreatedAt)
+		if err != nil {
+			return nil, "", queryError(err, nil)
+		}
+		if entry.Before, err = parseSnapshot(beforeJSON); err != nil {
+			return nil, "", err
+		}
+		if entry.After, err = parseSnapshot(afterJSON); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", queryError(err, nil)
+	}
+
+	return auditPage(entries, limit)
+}
+
+func parseSnapshot(b []byte) (*models.Company, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var company models.Company
+	if err := json.Unmarshal(b, &company); err != nil {
+		return nil, apperror.Wrap(apperror.Internal, err, "Unable to decode an audit snapshot")
+	}
+	return &company, nil
+}
+
+// auditPage cuts the entries fetched with one extra to the page size and returns the token of the next page
+func auditPage(entries []models.AuditEntry, limit int) ([]models.AuditEntry, string, error) {
+	var next string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = strconv.FormatInt(entries[limit-1].ID, 10)
+	}
+	return entries, next, nil
+}
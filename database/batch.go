@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// BatchOptions decide how the operations of a batch are applied
+type BatchOptions struct {
+	// Atomic stops at the first failure and rolls back every operation, otherwise
+	// only the failed operations are left out
+	Atomic bool
+	// DryRun rolls back the whole batch once tried, the results tell what it would do
+	DryRun bool
+	// Checkpoint, when set, saves the progress of a job along with the batch
+	Checkpoint *Checkpoint
+}
+
+// OperationResult is the outcome of an operation of a batch, the company is its state
+// after the change. Created tells an upsert that created the company from one that replaced it.
+type OperationResult struct {
+	Company models.Company
+	Created bool
+	Err     error
+}
+
+// apply the operations of a batch in one transaction, each in its own savepoint when
+// the batch isn't atomic so that a failure only rolls back its operation. A failed
+// atomic batch or a dry run goes back to the savepoint of the batch, its checkpoint is
+// still saved.
+func (s *PostgresStore) BatchCompaniesQuery(actor models.Actor, ops []models.CompanyOperation, options BatchOptions) ([]OperationResult, error) {
+	atomic := options.Atomic
+	var results []OperationResult
+	err := s.transact(func(tx *sql.Tx) error {
+		results = make([]OperationResult, 0, len(ops))
+		if _, err := tx.Exec(`SAVEPOINT batch`); err != nil {
+			return queryError(err, nil)
+		}
+
+		rollback := options.DryRun
+		for _, op := range ops {
+			if !atomic {
+				if _, err := tx.Exec(`SAVEPOINT batch_operation`); err != nil {
+					return queryError(err, nil)
+				}
+			}
+
+			result := applyOperation(tx, actor, op)
+			results = append(results, result)
+			err := result.Err
+
+			switch {
+			case err == nil && !atomic:
+				if _, err := tx.Exec(`RELEASE SAVEPOINT batch_operation`); err != nil {
+					return queryError(err, nil)
+				}
+			case err != nil && atomic:
+				rollback = true
+			case err != nil:
+				if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_operation`); err != nil {
+					return queryError(err, nil)
+				}
+			}
+			if err != nil && atomic {
+				break
+			}
+		}
+
+		if rollback {
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch`); err != nil {
+				return queryError(err, nil)
+			}
+		}
+		if options.Checkpoint != nil {
+			return saveCheckpoint(tx, options.Checkpoint, results)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// applyOperation applies an operation of a batch in a transaction
+func applyOperation(tx *sql.Tx, actor models.Actor, op models.CompanyOperation) OperationResult {
+	var result OperationResult
+	switch op.Op {
+	case models.BatchCreate:
+		result.Company, result.Err = insertCompany(tx, actor, *op.Company)
+		result.Created = result.Err == nil
+	case models.BatchUpdate:
+		company := *op.Company
+		company.Version = op.Version
+		result.Company, result.Err = updateCompany(tx, actor, op.ID, company)
+	case models.BatchDelete:
+		result.Company, result.Err = deleteCompany(tx, actor, op.ID, op.Version)
+	case models.BatchUpsert:
+		var id uuid.UUID
+		sqlStatement := `SELECT id FROM company WHERE lower(btrim(regexp_replace(name, '\s+', ' ', 'g'))) = $1 AND deleted_at IS NULL FOR UPDATE`
+		err := tx.QueryRow(sqlStatement, NormalizeName(op.Company.Name)).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			result.Company, result.Err = insertCompany(tx, actor, *op.Company)
+			result.Created = result.Err == nil
+		case err != nil:
+			result.Err = queryError(err, nil)
+		default:
+			company := *op.Company
+			company.Version = op.Version
+			result.Company, result.Err = updateCompany(tx, actor, id, company)
+		}
+	default:
+		result.Err = apperror.New(apperror.Validation, "Unknown operation %q", op.Op)
+	}
+	return result
+}
@@ -3,144 +3,256 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/logger"
 	models "github.com/jain-chetan/companyservice/model"
 
 	"github.com/google/uuid"
+	_ "github.com/lib/pq"
 )
 
-func CreateConnection() *sql.DB {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=postgres password=postgres dbname=testdb sslmode=disable")
+// DSN builds the postgres connection string of a db configuration
+func DSN(cfg models.DBConfig) string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return fmt.Sprintf("host='%s' port='%s' user='%s' password='%s' dbname='%s' sslmode='%s'",
+		quote.Replace(cfg.Host), quote.Replace(cfg.Port), quote.Replace(cfg.User),
+		quote.Replace(cfg.Password), quote.Replace(cfg.DBName), quote.Replace(cfg.SSLMode))
+}
+
+// Open creates the connection pool shared by the whole service and checks that the db is reachable
+func Open(cfg models.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = db.Ping()
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
+	err = db.Ping()
 	if err != nil {
-		panic(err)
+		db.Close()
+		return nil, err
 	}
 
-	fmt.Println("Successfully connected!")
-	return db
+	logger.Infof("Successfully connected to %s:%s/%s", cfg.Host, cfg.Port, cfg.DBName)
+	return db, nil
 }
 
-func CheckNameUniqueness(name string) (int, error) {
-	// create the postgres db connection
-	db := CreateConnection()
+// PostgresStore keeps the companies in a postgres database
+type PostgresStore struct {
+	db *sql.DB
+}
 
-	// close the db connection
-	defer db.Close()
-	var count int
-	query := `SELECT COUNT(*) FROM company WHERE name = $1`
-	err := db.QueryRow(query, name).Scan(&count)
-	if err != nil {
-		log.Printf("Unable to execute the query. %v", err)
-		return count, err
-	}
-	return count, nil
+// NewPostgresStore creates a company store on top of a connection pool
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
 
+// companyColumns are the columns scanned by scanCompany, in order
+const companyColumns = `id, name, description, employees, registered, type, version, deleted_at`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
-func CreateCompanyQuery(company models.Company) uuid.UUID {
 
-	// create the postgres db connection
-	db := CreateConnection()
+// scanCompany scans the company columns, then the extra columns selected after them
+func scanCompany(row rowScanner, company *models.Company, extra ...interface{}) error {
+	dest := []interface{}{&company.ID, &company.Name, &company.Description, &company.Employees, &company.Registered, &company.Type, &company.Version, &company.DeletedAt}
+	return row.Scan(append(dest, extra...)...)
+}
 
-	// close the db connection
-	defer db.Close()
+// transact runs fn in a transaction committed when fn succeeds
+func (s *PostgresStore) transact(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return queryError(err, nil)
+	}
+	defer tx.Rollback()
 
-	var id uuid.UUID
-	createTable := `CREATE TABLE IF NOT EXISTS company( ID uuid DEFAULT uuid_generate_v1(), NAME TEXT NOT NULL, DESCRIPTION TEXT NOT NULL, EMPLOYEES INT, REGISTERED BOOL, TYPE TEXT)`
-	_ = db.QueryRow(createTable)
-	sqlStatement := `INSERT INTO company (name, description,employees,registered,type) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return queryError(tx.Commit(), nil)
+}
 
-	// execute the sql statement
-	err := db.QueryRow(sqlStatement, company.Name, company.Description, company.Employees, company.Registered, company.Type).Scan(&id)
+// lockCompany reads a company and locks it until the end of the transaction, deleted ones included
+func lockCompany(tx *sql.Tx, id uuid.UUID) (models.Company, error) {
+	var company models.Company
+	err := scanCompany(tx.QueryRow(`SELECT `+companyColumns+` FROM company WHERE id=$1 FOR UPDATE`, id), &company)
+	return company, queryError(err, ErrCompanyNotFound)
+}
 
+// insert a company in the DB and return its id, ErrNameTaken is returned
+// when another company has the same name once normalized
+func (s *PostgresStore) CreateCompanyQuery(actor models.Actor, company models.Company) (uuid.UUID, error) {
+	err := s.transact(func(tx *sql.Tx) error {
+		var err error
+		company, err = insertCompany(tx, actor, company)
+		return err
+	})
 	if err != nil {
-		log.Printf("Unable to execute the query. %v", err)
+		return uuid.Nil, err
 	}
 
-	fmt.Printf("Inserted %v", id)
+	logger.Debugf("Inserted %v", company.ID)
 
 	// return the id
-	return id
+	return company.ID, nil
 }
 
-// get one company from the DB by its id
-func GetCompanyQuery(id uuid.UUID) (models.Company, error) {
-	// create the postgres db connection
-	db := CreateConnection()
+// insertCompany inserts a company in a transaction and returns it with its id and version
+func insertCompany(tx *sql.Tx, actor models.Actor, company models.Company) (models.Company, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return company, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+
+	sqlStatement := `INSERT INTO company (id, name, canonical_name, description, employees, registered, type, version) VALUES ($1, $2, $3, $4, $5, $6, $7, 1) RETURNING id`
+
+	// execute the sql statement
+	err = tx.QueryRow(sqlStatement, id, company.Name, CanonicalName(company.Name), company.Description, company.Employees, company.Registered, company.Type).Scan(&id)
+	if isUniqueViolation(err) {
+		return company, ErrNameTaken
+	}
+	if err != nil {
+		return company, queryError(err, nil)
+	}
+
+	company.ID, company.Version, company.DeletedAt = id, 1, nil
+	return company, recordChange(tx, actor, models.AuditCreate, nil, &company)
+}
 
-	// close the db connection
-	defer db.Close()
+// get one company from the DB by its id, the deleted companies are not found
+func (s *PostgresStore) GetCompanyQuery(id uuid.UUID) (models.Company, error) {
 
 	// create a company of models.company type
 	var company models.Company
 
 	// create the select sql query
-	sqlStatement := `SELECT * FROM company WHERE id=$1`
-
-	// execute the sql statement
-	row := db.QueryRow(sqlStatement, id)
+	sqlStatement := `SELECT ` + companyColumns + ` FROM company WHERE id=$1 AND deleted_at IS NULL`
 
-	// unmarshal the row object to company
-	err := row.Scan(&company.ID, &company.Name, &company.Description, &company.Employees, &company.Registered, &company.Type)
-
-	switch err {
-	case sql.ErrNoRows:
-		fmt.Println("No rows were returned!")
-		return company, err
-	case nil:
-		return company, nil
-	default:
-		log.Printf("Unable to scan the row. %v", err)
-	}
+	// execute the sql statement and unmarshal the row object to company
+	err := scanCompany(s.db.QueryRow(sqlStatement, id), &company)
+	return company, queryError(err, ErrCompanyNotFound)
+}
 
-	// return empty company on error
+// update company in the DB and return it with its new version. The update only applies to the
+// version of company.Version when it is set, ErrVersionMismatch is returned otherwise.
+// Renaming it to the name of another company returns ErrNameTaken.
+func (s *PostgresStore) PatchCompanyQuery(actor models.Actor, id uuid.UUID, company models.Company) (models.Company, error) {
+	err := s.transact(func(tx *sql.Tx) error {
+		var err error
+		company, err = updateCompany(tx, actor, id, company)
+		return err
+	})
 	return company, err
 }
 
-// update company in the DB
-func PatchCompanyQuery(id uuid.UUID, company models.Company) uuid.UUID {
-
-	// create the postgres db connection
-	db := CreateConnection()
-
-	// close the db connection
-	defer db.Close()
+// updateCompany replaces a company in a transaction and returns it with its new version
+func updateCompany(tx *sql.Tx, actor models.Actor, id uuid.UUID, company models.Company) (models.Company, error) {
+	before, err := lockCompany(tx, id)
+	if err != nil {
+		return company, err
+	}
+	if before.DeletedAt != nil {
+		return company, ErrCompanyNotFound
+	}
+	if company.Version != 0 && company.Version != before.Version {
+		return company, ErrVersionMismatch
+	}
 
 	// create the update sql query
-	sqlStatement := `UPDATE company SET name=$2, description=$3, employees=$4, registered=$5, type=$6 WHERE id=$1`
+	sqlStatement := `UPDATE company SET name=$2, canonical_name=$3, description=$4, employees=$5, registered=$6, type=$7, version=version+1
+		WHERE id=$1 RETURNING version`
 
 	// execute the sql statement
-	_, err := db.Exec(sqlStatement, id, company.Name, company.Description, company.Employees, company.Registered, company.Type)
-
+	company.ID, company.DeletedAt = id, nil
+	err = tx.QueryRow(sqlStatement, id, company.Name, CanonicalName(company.Name), company.Description, company.Employees, company.Registered, company.Type).Scan(&company.Version)
+	if isUniqueViolation(err) {
+		return company, ErrNameTaken
+	}
 	if err != nil {
-		log.Printf("Unable to execute the query. %v", err)
+		return company, queryError(err, nil)
 	}
+	return company, recordChange(tx, actor, models.AuditUpdate, &before, &company)
+}
 
-	return id
+// delete company in the DB, only at the given version when it isn't 0. The company is only
+// marked deleted, it can be restored until it is purged.
+func (s *PostgresStore) DeleteCompanyQuery(actor models.Actor, id uuid.UUID, version int64) error {
+	return s.transact(func(tx *sql.Tx) error {
+		_, err := deleteCompany(tx, actor, id, version)
+		return err
+	})
 }
 
-// delete company in the DB
-func DeleteCompanyQuery(id uuid.UUID) uuid.UUID {
+// deleteCompany marks a company deleted in a transaction and returns it
+func deleteCompany(tx *sql.Tx, actor models.Actor, id uuid.UUID, version int64) (models.Company, error) {
+	before, err := lockCompany(tx, id)
+	if err != nil {
+		return before, err
+	}
+	if before.DeletedAt != nil {
+		return before, ErrCompanyNotFound
+	}
+	if version != 0 && version != before.Version {
+		return before, ErrVersionMismatch
+	}
+
+	sqlStatement := `UPDATE company SET deleted_at=now(), version=version+1 WHERE id=$1 RETURNING ` + companyColumns
+
+	// execute the sql statement
+	var company models.Company
+	if err := scanCompany(tx.QueryRow(sqlStatement, id), &company); err != nil {
+		return before, queryError(err, nil)
+	}
+	return company, recordChange(tx, actor, models.AuditDelete, &before, nil)
+}
 
-	// create the postgres db connection
-	db := CreateConnection()
+// restore a deleted company in the DB and return it, restoring it while another company
+// has taken its name returns ErrNameTaken
+func (s *PostgresStore) RestoreCompanyQuery(actor models.Actor, id uuid.UUID) (models.Company, error) {
+	var company models.Company
 
-	// close the db connection
-	defer db.Close()
+	sqlStatement := `UPDATE company SET deleted_at=NULL, version=version+1 WHERE id=$1 RETURNING ` + companyColumns
+
+	err := s.transact(func(tx *sql.Tx) error {
+		before, err := lockCompany(tx, id)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			return ErrNotDeleted
+		}
+
+		// execute the sql statement
+		err = scanCompany(tx.QueryRow(sqlStatement, id), &company)
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
+		if err != nil {
+			return queryError(err, nil)
+		}
+		return recordChange(tx, actor, models.AuditRestore, &before, &company)
+	})
+	return company, err
+}
 
-	sqlStatement := `DELETE FROM company WHERE id=$1`
+// permanently delete from the DB the companies deleted before a time and return their number
+func (s *PostgresStore) PurgeCompaniesQuery(deletedBefore time.Time) (int64, error) {
+	sqlStatement := `DELETE FROM company WHERE deleted_at < $1`
 
 	// execute the sql statement
-	_, err := db.Exec(sqlStatement, id)
-
+	res, err := s.db.Exec(sqlStatement, deletedBefore)
 	if err != nil {
-		log.Printf("Unable to execute the query. %v", err)
+		return 0, queryError(err, nil)
 	}
-
-	return id
+	count, err := res.RowsAffected()
+	return count, queryError(err, nil)
 }
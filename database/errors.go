@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/logger"
+
+	"github.com/lib/pq"
+)
+
+// the errors of the store are domain errors, the handlers send them as they are
+var (
+	ErrCompanyNotFound      = apperror.New(apperror.NotFound, "Company not found")
+	ErrNameTaken            = apperror.New(apperror.Conflict, "Name not unique")
+	ErrNotDeleted           = apperror.New(apperror.Conflict, "Company is not deleted")
+	ErrVersionMismatch      = apperror.New(apperror.PreconditionFailed, "The company was changed since the version given")
+	ErrUserNotFound         = apperror.New(apperror.NotFound, "User not found")
+	ErrEmailTaken           = apperror.New(apperror.Conflict, "Email already registered")
+	ErrRefreshTokenNotFound = apperror.New(apperror.NotFound, "Refresh token not found")
+	ErrTokenReused          = apperror.New(apperror.Unauthorized, "Refresh token already used")
+	ErrWebhookNotFound      = apperror.New(apperror.NotFound, "Webhook not found")
+	ErrDeliveryNotFound     = apperror.New(apperror.NotFound, "Delivery not found")
+	ErrEventNotFound        = apperror.New(apperror.NotFound, "Event not found")
+	ErrJobNotFound          = apperror.New(apperror.NotFound, "Job not found")
+	ErrJobFinished          = apperror.New(apperror.Conflict, "The job has already finished")
+	ErrJobLeaseLost         = apperror.New(apperror.Conflict, "The job was cancelled or taken over by another worker")
+)
+
+// uniqueViolation is the postgres error code of a duplicate key
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// NormalizeName is the form of a company name that must be unique, it matches
+// the expression of the company_name_normalized_key index
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// queryError converts the error of a query to a domain error, sql.ErrNoRows becomes notFound
+// and every other error is logged and reported as internal
+func queryError(err error, notFound *apperror.Error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows) && notFound != nil:
+		return notFound
+	}
+	logger.Errorf("Unable to execute the query. %v", err)
+	return apperror.Wrap(apperror.Internal, err, "Unable to execute the query")
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// JobStore keeps the background jobs, their input and their progress
+type JobStore interface {
+	// CreateJobQuery queues a job along with the input it works on
+	CreateJobQuery(job models.Job, input []byte) (models.Job, error)
+	GetJobQuery(id uuid.UUID) (models.Job, error)
+	// CancelJobQuery cancels a queued or running job, a running job is stopped by its next checkpoint
+	CancelJobQuery(id uuid.UUID) (models.Job, error)
+	// ClaimJobQuery takes the oldest queued job, or a running one whose worker let its lease
+	// expire, for the lease. ok is false when no job is waiting.
+	ClaimJobQuery(lease time.Duration) (job ClaimedJob, ok bool, err error)
+	// FinishJobQuery ends a job with its final report, its input is dropped
+	FinishJobQuery(lease JobLease, status models.JobStatus, report models.ImportReport, problem *apperror.Problem) error
+	// ReleaseJobQuery hands a running job over to the other workers right away, when its worker
+	// stops. The attempt is given back, only the workers lost count against the job.
+	ReleaseJobQuery(lease JobLease) error
+}
+
+// JobLease is the right of a worker to run a job, until it expires or the job is cancelled.
+// Every checkpoint of the job extends it by the duration.
+type JobLease struct {
+	JobID    uuid.UUID
+	ID       uuid.UUID
+	Duration time.Duration
+}
+
+// ClaimedJob is a job taken by a worker, with its input
+type ClaimedJob struct {
+	models.Job
+	Lease JobLease
+	Input []byte
+}
+
+// Checkpoint saves the report of a job in the transaction of a batch, so that a job
+// resumed after a restart never skips a row nor applies one twice
+type Checkpoint struct {
+	Lease JobLease
+	// Report returns the report of the job once the results of the batch are counted
+	Report func(results []OperationResult) models.ImportReport
+}
+
+const jobColumns = `id, type, status, params, report, error, attempts, created_by, request_id, created_at, started_at, finished_at, updated_at`
+
+func scanJob(row rowScanner, job *models.Job) error {
+	var params, report, problem []byte
+	err := row.Scan(&job.ID, &job.Type, &job.Status, &params, &report, &problem, &job.Attempts,
+		&job.CreatedBy, &job.RequestID, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(params, &job.Params); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(report, &job.Report); err != nil {
+		return err
+	}
+	if problem != nil {
+		job.Error = &apperror.Problem{}
+		return json.Unmarshal(problem, job.Error)
+	}
+	return nil
+}
+
+// encodeJSON encodes a value of a JSONB column
+func encodeJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", apperror.Wrap(apperror.Internal, err, "Unable to encode the %T", v)
+	}
+	return string(data), nil
+}
+
+// insert a job in the DB, queued
+func (s *PostgresStore) CreateJobQuery(job models.Job, input []byte) (models.Job, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return job, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	job.ID = id
+	job.Status = models.JobQueued
+	params, err := encodeJSON(job.Params)
+	if err != nil {
+		return job, err
+	}
+	report, err := encodeJSON(job.Report)
+	if err != nil {
+		return job, err
+	}
+
+	sqlStatement := `INSERT INTO jobs (id, type, status, params, input, report, created_by, request_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING ` + jobColumns
+
+	// execute the sql statement
+	err = scanJob(s.db.QueryRow(sqlStatement, job.ID, job.Type, job.Status, params, input, report, job.CreatedBy, job.RequestID), &job)
+	return job, queryError(err, nil)
+}
+
+func (s *PostgresStore) GetJobQuery(id uuid.UUID) (models.Job, error) {
+	var job models.Job
+
+	sqlStatement := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	// execute the sql statement
+	err := scanJob(s.db.QueryRow(sqlStatement, id), &job)
+	return job, queryError(err, ErrJobNotFound)
+}
+
+// cancel a job that isn't finished, its lease is revoked so that its worker stops
+func (s *PostgresStore) CancelJobQuery(id uuid.UUID) (models.Job, error) {
+	var job models.Job
+	err := s.transact(func(tx *sql.Tx) error {
+		var status models.JobStatus
+		err := tx.QueryRow(`SELECT status FROM jobs WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+		if err != nil {
+			return queryError(err, ErrJobNotFound)
+		}
+		if status.Finished() {
+			return ErrJobFinished
+		}
+
+		sqlStatement := `UPDATE jobs SET status = 'cancelled', input = NULL, lease_id = NULL, lease_expires_at = NULL,
+			finished_at = now(), updated_at = now() WHERE id = $1 RETURNING ` + jobColumns
+
+		// execute the sql statement
+		return queryError(scanJob(tx.QueryRow(sqlStatement, id), &job), nil)
+	})
+	return job, err
+}
+
+// claim the oldest job waiting, the job rows stay locked until claimed so that two workers never take the same one
+func (s *PostgresStore) ClaimJobQuery(lease time.Duration) (ClaimedJob, bool, error) {
+	claimed := ClaimedJob{Lease: JobLease{ID: uuid.New(), Duration: lease}}
+
+	sqlStatement := `UPDATE jobs SET status = 'running', lease_id = $1, lease_expires_at = now() + make_interval(secs => $2),
+		attempts = attempts + 1, started_at = COALESCE(started_at, now()), updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs WHERE status = 'queued' OR (status = 'running' AND lease_expires_at <= now())
+			ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING ` + jobColumns + `, input`
+
+	// execute the sql statement
+	row := s.db.QueryRow(sqlStatement, claimed.Lease.ID, lease.Seconds())
+	var params, report, problem []byte
+	job := &claimed.Job
+	err := row.Scan(&job.ID, &job.Type, &job.Status, &params, &report, &problem, &job.Attempts,
+		&job.CreatedBy, &job.RequestID, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.UpdatedAt, &claimed.Input)
+	if err == sql.ErrNoRows {
+		return claimed, false, nil
+	}
+	if err != nil {
+		return claimed, false, queryError(err, nil)
+	}
+	if err := json.Unmarshal(params, &job.Params); err != nil {
+		return claimed, false, apperror.Wrap(apperror.Internal, err, "Unable to decode the params of the job %s", job.ID)
+	}
+	if err := json.Unmarshal(report, &job.Report); err != nil {
+		return claimed, false, apperror.Wrap(apperror.Internal, err, "Unable to decode the report of the job %s", job.ID)
+	}
+	claimed.Lease.JobID = job.ID
+	return claimed, true, nil
+}
+
+func (s *PostgresStore) FinishJobQuery(lease JobLease, status models.JobStatus, report models.ImportReport, problem *apperror.Problem) error {
+	encodedReport, err := encodeJSON(report)
+	if err != nil {
+		return err
+	}
+	var encodedProblem *string
+	if problem != nil {
+		encoded, err := encodeJSON(problem)
+		if err != nil {
+			return err
+		}
+		encodedProblem = &encoded
+	}
+
+	sqlStatement := `UPDATE jobs SET status = $3, report = $4, error = $5, input = NULL, lease_id = NULL, lease_expires_at = NULL,
+		finished_at = now(), updated_at = now() WHERE id = $1 AND lease_id = $2 AND status = 'running'`
+
+	// execute the sql statement
+	res, err := s.db.Exec(sqlStatement, lease.JobID, lease.ID, status, encodedReport, encodedProblem)
+	return leaseResult(res, err)
+}
+
+func (s *PostgresStore) ReleaseJobQuery(lease JobLease) error {
+	sqlStatement := `UPDATE jobs SET lease_expires_at = now(), attempts = attempts - 1 WHERE id = $1 AND lease_id = $2 AND status = 'running'`
+
+	// execute the sql statement
+	_, err := s.db.Exec(sqlStatement, lease.JobID, lease.ID)
+	return queryError(err, nil)
+}
+
+// saveCheckpoint saves the report of a job in the transaction of a batch and extends its lease
+func saveCheckpoint(tx *sql.Tx, checkpoint *Checkpoint, results []OperationResult) error {
+	report, err := encodeJSON(checkpoint.Report(results))
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `UPDATE jobs SET report = $3, lease_expires_at = now() + make_interval(secs => $4), updated_at = now()
+		WHERE id = $1 AND lease_id = $2 AND status = 'running'`
+
+	// execute the sql statement
+	res, err := tx.Exec(sqlStatement, checkpoint.Lease.JobID, checkpoint.Lease.ID, report, checkpoint.Lease.Duration.Seconds())
+	return leaseResult(res, err)
+}
+
+// leaseResult returns ErrJobLeaseLost when the update of a job under a lease changed no row
+func leaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return queryError(err, nil)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return queryError(err, nil)
+	}
+	if count == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
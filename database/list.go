@@ -0,0 +1,250 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var (
+	ErrInvalidSort   = apperror.New(apperror.Validation, "invalid sort field")
+	ErrInvalidCursor = apperror.New(apperror.Validation, "invalid cursor")
+)
+
+// sortColumns maps the json name of every models.Company field to its column
+var sortColumns = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"description": "description",
+	"employees":   "employees",
+	"registered":  "registered",
+	"type":        "type",
+}
+
+// cursor is the position of the last company of a page
+type cursor struct {
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor reads a cursor of a list sorted on field, its value must be of the type
+// of the field since the cursor comes from the client
+func decodeCursor(token string, field string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	switch field {
+	case "employees":
+		_, err = strconv.ParseInt(c.Value, 10, 32)
+	case "registered":
+		_, err = strconv.ParseBool(c.Value)
+	case "id":
+		_, err = uuid.Parse(c.Value)
+	}
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sortValue returns the value of the sort field of a company as it is kept in the cursor
+func sortValue(company models.Company, field string) string {
+	switch field {
+	case "name":
+		return company.Name
+	case "description":
+		return company.Description
+	case "employees":
+		return fmt.Sprint(company.Employees)
+	case "registered":
+		return fmt.Sprint(company.Registered)
+	case "type":
+		return string(company.Type)
+	}
+	return company.ID.String()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// listParams returns the sort field and the page size of a list, with their defaults applied
+func listParams(filter models.CompanyFilter) (string, int, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = "name"
+	}
+	if _, ok := sortColumns[sort]; !ok {
+		return "", 0, ErrInvalidSort
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	return sort, limit, nil
+}
+
+// conditions builds the WHERE clause of a query along with its arguments
+type conditions struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add appends a condition whose %s verbs are replaced by the placeholders of the values
+func (c *conditions) add(format string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, v := range values {
+		c.args = append(c.args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(c.args))
+	}
+	c.conditions = append(c.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+func (c *conditions) clause() string {
+	if len(c.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.conditions, " AND ")
+}
+
+// filterConditions returns the conditions of the companies matching a filter, its cursor aside
+func filterConditions(filter models.CompanyFilter) *conditions {
+	where := &conditions{}
+	if !filter.IncludeDeleted {
+		where.conditions = append(where.conditions, "deleted_at IS NULL")
+	}
+	if filter.Type != "" {
+		where.add("type = %s", filter.Type)
+	}
+	if filter.Registered != nil {
+		where.add("registered = %s", *filter.Registered)
+	}
+	if filter.MinEmployees != nil {
+		where.add("employees >= %s", *filter.MinEmployees)
+	}
+	if filter.MaxEmployees != nil {
+		where.add("employees <= %s", *filter.MaxEmployees)
+	}
+	if filter.NamePrefix != "" {
+		where.add("name LIKE %s || '%%'", escapeLike(filter.NamePrefix))
+	}
+	return where
+}
+
+// list the companies matching the filter, one page at a time
+func (s *PostgresStore) ListCompaniesQuery(filter models.CompanyFilter) ([]models.Company, string, error) {
+	sort, limit, err := listParams(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	column := sortColumns[sort]
+
+	where := filterConditions(filter)
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor, sort)
+		if err != nil {
+			return nil, "", err
+		}
+		where.add("("+column+", id) "+comparison+" (%s, %s)", c.Value, c.ID)
+	}
+
+	sqlStatement := `SELECT ` + companyColumns + ` FROM company` + where.clause()
+	// fetch one extra row to know whether there is a next page
+	where.args = append(where.args, limit+1)
+	sqlStatement += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", column, direction, direction, len(where.args))
+
+	rows, err := s.db.Query(sqlStatement, where.args...)
+	if err != nil {
+		return nil, "", queryError(err, nil)
+	}
+	defer rows.Close()
+
+	companies := []models.Company{}
+	for rows.Next() {
+		var company models.Company
+		err := scanCompany(rows, &company)
+		if err != nil {
+			return nil, "", queryError(err, nil)
+		}
+		companies = append(companies, company)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", queryError(err, nil)
+	}
+
+	var next string
+	if len(companies) > limit {
+		companies = companies[:limit]
+		last := companies[limit-1]
+		next = encodeCursor(cursor{Value: sortValue(last, sort), ID: last.ID})
+	}
+	return companies, next, nil
+}
+
+// ExportCompaniesQuery calls fn with every company matching the filter, in the order of its sort.
+// The rows are read as they come so that any number of companies can be exported, fn stops
+// the export by returning an error.
+func (s *PostgresStore) ExportCompaniesQuery(filter models.CompanyFilter, fn func(company models.Company) error) error {
+	sort, _, err := listParams(filter)
+	if err != nil {
+		return err
+	}
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	where := filterConditions(filter)
+	sqlStatement := `SELECT ` + companyColumns + ` FROM company` + where.clause() +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", sortColumns[sort], direction, direction)
+
+	rows, err := s.db.Query(sqlStatement, where.args...)
+	if err != nil {
+		return queryError(err, nil)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var company models.Company
+		if err := scanCompany(rows, &company); err != nil {
+			return queryError(err, nil)
+		}
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+	return queryError(rows.Err(), nil)
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeCursorChecksValueType(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		valid bool
+	}{
+		{"name", "Acme", true},
+		{"employees", "42", true},
+		{"employees", "many", false},
+		{"employees", "99999999999", false},
+		{"registered", "true", true},
+		{"registered", "yes", false},
+		{"id", uuid.NewString(), true},
+		{"id", "1", false},
+	}
+	for _, test := range tests {
+		token := encodeCursor(cursor{Value: test.value, ID: uuid.New()})
+		_, err := decodeCursor(token, test.field)
+		if test.valid && err != nil {
+			t.Errorf("%s=%q: unexpected error %v", test.field, test.value, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s=%q: got %v, want ErrInvalidCursor", test.field, test.value, err)
+		}
+	}
+
+	if _, err := decodeCursor(base64.RawURLEncoding.EncodeToString([]byte("{")), "name"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("malformed cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,1038 @@
+package database
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps the companies in memory, it is safe for concurrent use
+type MemoryStore struct {
+	mu        sync.RWMutex
+	companies map[uuid.UUID]models.Company
+	users     map[string]models.User
+	// refresh tokens by hash and revoked access tokens by jti with their expiry
+	refreshTokens map[string]models.RefreshToken
+	revoked       map[string]time.Time
+	// audit is the audit log, oldest first
+	audit []models.AuditEntry
+	// outbox has the events not published yet, oldest first
+	outbox []*memoryEvent
+	// webhooks by id and their deliveries, oldest first
+	webhooks   map[uuid.UUID]models.Webhook
+	deliveries []*memoryDelivery
+	// jobs by id, with their input and lease
+	jobs map[uuid.UUID]*memoryJob
+}
+
+// memoryDelivery is a delivery with the event it posts, its attempts are newest first
+type memoryDelivery struct {
+	models.WebhookDelivery
+	payload []byte
+}
+
+// memoryEvent is an event of the outbox with its attempts, it is parked once out of attempts
+type memoryEvent struct {
+	models.PendingEvent
+	lastError     string
+	nextAttemptAt time.Time
+	parked        bool
+}
+
+// memoryJob is a job with its input and the lease of the worker running it
+type memoryJob struct {
+	models.Job
+	input          []byte
+	lease          uuid.UUID
+	leaseExpiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory company store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		companies:     make(map[uuid.UUID]models.Company),
+		users:         make(map[string]models.User),
+		refreshTokens: make(map[string]models.RefreshToken),
+		revoked:       make(map[string]time.Time),
+		webhooks:      make(map[uuid.UUID]models.Webhook),
+		jobs:          make(map[uuid.UUID]*memoryJob),
+	}
+}
+
+// nameTaken reports whether another company has the same name once normalized, the lock must be held
+func (s *MemoryStore) nameTaken(name string, id uuid.UUID) bool {
+	key := NormalizeName(name)
+	for _, company := range s.companies {
+		if company.ID != id && company.DeletedAt == nil && NormalizeName(company.Name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// companyNamed returns the company that isn't deleted with the same name once normalized, the lock must be held
+func (s *MemoryStore) companyNamed(name string) (models.Company, bool) {
+	key := NormalizeName(name)
+	for _, company := range s.companies {
+		if company.DeletedAt == nil && NormalizeName(company.Name) == key {
+			return company, true
+		}
+	}
+	return models.Company{}, false
+}
+
+// record appends a change of a company to the audit log and its event to the outbox, the lock must be held
+func (s *MemoryStore) record(actor models.Actor, action models.AuditAction, before, after *models.Company) {
+	entry := models.AuditEntry{
+		ID:        int64(len(s.audit) + 1),
+		Action:    action,
+		Subject:   actor.Subject,
+		RequestID: actor.RequestID,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now(),
+	}
+	if before != nil {
+		entry.CompanyID = before.ID
+	} else {
+		entry.CompanyID = after.ID
+	}
+	s.audit = append(s.audit, entry)
+	s.outbox = append(s.outbox, &memoryEvent{PendingEvent: models.PendingEvent{Event: newEvent(actor, action, before, after)}})
+}
+
+func (s *MemoryStore) ClaimEventsQuery(limit int, lease time.Duration) ([]models.PendingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	claimed := []models.PendingEvent{}
+	for _, e := range s.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if e.parked || e.nextAttemptAt.After(now) {
+			continue
+		}
+		e.nextAttemptAt = now.Add(lease)
+		claimed = append(claimed, e.PendingEvent)
+	}
+	return claimed, nil
+}
+
+// record an attempt to publish an event, the published ones are removed from the outbox
+func (s *MemoryStore) RecordEventAttemptQuery(eventID uuid.UUID, publishErr string, next *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.outbox {
+		if e.ID != eventID {
+			continue
+		}
+		if publishErr == "" {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			return nil
+		}
+		e.Attempts++
+		e.lastError = publishErr
+		if next == nil {
+			e.parked = true
+		} else {
+			e.nextAttemptAt = *next
+		}
+		return nil
+	}
+	return ErrEventNotFound
+}
+
+func (s *MemoryStore) CreateCompanyQuery(actor models.Actor, company models.Company) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, err := s.createCompany(actor, company)
+	return company.ID, err
+}
+
+// createCompany adds a company and returns it with its id and version, the lock must be held
+func (s *MemoryStore) createCompany(actor models.Actor, company models.Company) (models.Company, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return company, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	if s.nameTaken(company.Name, id) {
+		return company, ErrNameTaken
+	}
+	company.ID = id
+	company.Version = 1
+	company.DeletedAt = nil
+	s.companies[id] = company
+	s.record(actor, models.AuditCreate, nil, &company)
+	return company, nil
+}
+
+func (s *MemoryStore) GetCompanyQuery(id uuid.UUID) (models.Company, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	company, ok := s.companies[id]
+	if !ok || company.DeletedAt != nil {
+		return models.Company{}, ErrCompanyNotFound
+	}
+	return company, nil
+}
+
+func (s *MemoryStore) ListCompaniesQuery(filter models.CompanyFilter) ([]models.Company, string, error) {
+	field, limit, err := listParams(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var after *cursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor, field)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	compare := companyOrder(field, filter.Descending)
+
+	s.mu.RLock()
+	companies := []models.Company{}
+	for _, company := range s.companies {
+		if matchesFilter(company, filter) && (after == nil || compare(company, after.Value, after.ID) > 0) {
+			companies = append(companies, company)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(companies, func(i, j int) bool {
+		return compare(companies[i], sortValue(companies[j], field), companies[j].ID) < 0
+	})
+
+	var next string
+	if len(companies) > limit {
+		companies = companies[:limit]
+		last := companies[limit-1]
+		next = encodeCursor(cursor{Value: sortValue(last, field), ID: last.ID})
+	}
+	return companies, next, nil
+}
+
+// search the companies like the postgres store: every token starting a word of the name or
+// description, or a name close enough to the query, with the same weights and highlights
+func (s *MemoryStore) SearchCompaniesQuery(query string, limit int) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	queryWords := searchWords(query)
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return results, nil
+	}
+
+	s.mu.RLock()
+	for _, company := range s.companies {
+		if company.DeletedAt != nil {
+			continue
+		}
+		name := searchWords(company.Name)
+		rank, matched := textRank(tokens, name, searchWords(company.Description))
+		similarity := wordSimilarity(queryWords, name)
+		if !matched && similarity < fuzzyThreshold {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			Company: company,
+			Score:   rank + similarity,
+			Highlights: models.Highlights{
+				Name:        highlight(company.Name, tokens),
+				Description: snippet(company.Description, tokens),
+			},
+		})
+	}
+	s.mu.RUnlock()
+
+	sortSearchResults(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) SimilarCompaniesQuery(name string) ([]models.SimilarCompany, error) {
+	canonical := CanonicalName(name)
+	if canonical == "" {
+		return []models.SimilarCompany{}, nil
+	}
+
+	s.mu.RLock()
+	var companies []models.Company
+	for _, company := range s.companies {
+		if company.DeletedAt == nil {
+			companies = append(companies, company)
+		}
+	}
+	s.mu.RUnlock()
+	return similarCompanies(canonical, companies), nil
+}
+
+// companyOrder returns the order of a company relative to a sort value and id
+func companyOrder(field string, descending bool) func(company models.Company, value string, id uuid.UUID) int {
+	return func(company models.Company, value string, id uuid.UUID) int {
+		cmp := compareSortValue(company, field, value)
+		if cmp == 0 {
+			cmp = strings.Compare(company.ID.String(), id.String())
+		}
+		if descending {
+			cmp = -cmp
+		}
+		return cmp
+	}
+}
+
+func (s *MemoryStore) ExportCompaniesQuery(filter models.CompanyFilter, fn func(company models.Company) error) error {
+	field, _, err := listParams(filter)
+	if err != nil {
+		return err
+	}
+	compare := companyOrder(field, filter.Descending)
+
+	s.mu.RLock()
+	companies := []models.Company{}
+	for _, company := range s.companies {
+		if matchesFilter(company, filter) {
+			companies = append(companies, company)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(companies, func(i, j int) bool {
+		return compare(companies[i], sortValue(companies[j], field), companies[j].ID) < 0
+	})
+	for _, company := range companies {
+		if err := fn(company); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PatchCompanyQuery(actor models.Actor, id uuid.UUID, company models.Company) (models.Company, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateCompany(actor, id, company)
+}
+
+// updateCompany replaces a company and returns it with its new version, the lock must be held
+func (s *MemoryStore) updateCompany(actor models.Actor, id uuid.UUID, company models.Company) (models.Company, error) {
+	current, ok := s.companies[id]
+	if !ok || current.DeletedAt != nil {
+		return company, ErrCompanyNotFound
+	}
+	if company.Version != 0 && company.Version != current.Version {
+		return company, ErrVersionMismatch
+	}
+	if s.nameTaken(company.Name, id) {
+		return company, ErrNameTaken
+	}
+	company.ID = id
+	company.Version = current.Version + 1
+	company.DeletedAt = nil
+	s.companies[id] = company
+	after := company
+	s.record(actor, models.AuditUpdate, &current, &after)
+	return company, nil
+}
+
+func (s *MemoryStore) DeleteCompanyQuery(actor models.Actor, id uuid.UUID, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteCompany(actor, id, version)
+	return err
+}
+
+// deleteCompany marks a company deleted and returns it, the lock must be held
+func (s *MemoryStore) deleteCompany(actor models.Actor, id uuid.UUID, version int64) (models.Company, error) {
+	current, ok := s.companies[id]
+	if !ok || current.DeletedAt != nil {
+		return current, ErrCompanyNotFound
+	}
+	if version != 0 && version != current.Version {
+		return current, ErrVersionMismatch
+	}
+	before := current
+	now := time.Now()
+	current.DeletedAt = &now
+	current.Version++
+	s.companies[id] = current
+	s.record(actor, models.AuditDelete, &before, nil)
+	return current, nil
+}
+
+func (s *MemoryStore) BatchCompaniesQuery(actor models.Actor, ops []models.CompanyOperation, options BatchOptions) ([]OperationResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the state a failed atomic batch, a dry run or a batch whose checkpoint fails goes back to.
+	// The operations change nothing when they fail so the others don't need it.
+	var companies map[uuid.UUID]models.Company
+	auditLen, outboxLen := len(s.audit), len(s.outbox)
+	rollback := func() {
+		s.companies = companies
+		s.audit = s.audit[:auditLen]
+		s.outbox = s.outbox[:outboxLen]
+	}
+	if options.Atomic || options.DryRun || options.Checkpoint != nil {
+		companies = make(map[uuid.UUID]models.Company, len(s.companies))
+		for id, company := range s.companies {
+			companies[id] = company
+		}
+	}
+
+	results := make([]OperationResult, 0, len(ops))
+	for _, op := range ops {
+		result := s.applyOperation(actor, op)
+		results = append(results, result)
+		if result.Err != nil && options.Atomic {
+			rollback()
+			break
+		}
+	}
+	if options.DryRun {
+		rollback()
+	}
+	if options.Checkpoint != nil {
+		if err := s.saveCheckpoint(options.Checkpoint, results); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// applyOperation applies an operation of a batch, the lock must be held
+func (s *MemoryStore) applyOperation(actor models.Actor, op models.CompanyOperation) OperationResult {
+	var result OperationResult
+	switch op.Op {
+	case models.BatchCreate:
+		result.Company, result.Err = s.createCompany(actor, *op.Company)
+		result.Created = result.Err == nil
+	case models.BatchUpdate:
+		company := *op.Company
+		company.Version = op.Version
+		result.Company, result.Err = s.updateCompany(actor, op.ID, company)
+	case models.BatchDelete:
+		result.Company, result.Err = s.deleteCompany(actor, op.ID, op.Version)
+	case models.BatchUpsert:
+		company := *op.Company
+		company.Version = op.Version
+		if existing, ok := s.companyNamed(company.Name); ok {
+			result.Company, result.Err = s.updateCompany(actor, existing.ID, company)
+		} else {
+			result.Company, result.Err = s.createCompany(actor, company)
+			result.Created = result.Err == nil
+		}
+	default:
+		result.Err = apperror.New(apperror.Validation, "Unknown operation %q", op.Op)
+	}
+	return result
+}
+
+func (s *MemoryStore) RestoreCompanyQuery(actor models.Actor, id uuid.UUID) (models.Company, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, ok := s.companies[id]
+	if !ok {
+		return models.Company{}, ErrCompanyNotFound
+	}
+	if company.DeletedAt == nil {
+		return models.Company{}, ErrNotDeleted
+	}
+	if s.nameTaken(company.Name, id) {
+		return models.Company{}, ErrNameTaken
+	}
+	before := company
+	company.DeletedAt = nil
+	company.Version++
+	s.companies[id] = company
+	after := company
+	s.record(actor, models.AuditRestore, &before, &after)
+	return company, nil
+}
+
+func (s *MemoryStore) PurgeCompaniesQuery(deletedBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for id, company := range s.companies {
+		if company.DeletedAt != nil && company.DeletedAt.Before(deletedBefore) {
+			delete(s.companies, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) ListAuditQuery(filter models.AuditFilter) ([]models.AuditEntry, string, error) {
+	before, err := auditCursor(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := auditLimit(filter)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0 && len(entries) <= limit; i-- {
+		entry := s.audit[i]
+		if before != 0 && entry.ID >= before {
+			continue
+		}
+		if filter.CompanyID != nil && entry.CompanyID != *filter.CompanyID {
+			continue
+		}
+		if filter.Subject != "" && entry.Subject != filter.Subject {
+			continue
+		}
+		if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+		if filter.Since != nil && entry.CreatedAt.Before(*filter.Since) {
+			continue
+		}
+		if filter.Until != nil && !entry.CreatedAt.Before(*filter.Until) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return auditPage(entries, limit)
+}
+
+func (s *MemoryStore) CreateUserQuery(user models.User) (models.User, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return user, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := normalizeEmail(user.Email)
+	if _, ok := s.users[key]; ok {
+		return user, ErrEmailTaken
+	}
+	user.ID = id
+	user.Password = ""
+	user.CreatedAt = time.Now()
+	s.users[key] = user
+	return user, nil
+}
+
+func (s *MemoryStore) GetUserQuery(id uuid.UUID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) GetUserByEmailQuery(email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[normalizeEmail(email)]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) UpdateUserRoleQuery(id uuid.UUID, role models.Role) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, user := range s.users {
+		if user.ID == id {
+			user.Role = role
+			s.users[key] = user
+			return user, nil
+		}
+	}
+	return models.User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) CreateRefreshTokenQuery(token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (s *MemoryStore) UseRefreshTokenQuery(tokenHash string) (models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	token, ok := s.refreshTokens[tokenHash]
+	if !ok || !token.ExpiresAt.After(now) {
+		return models.RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		return token, ErrTokenReused
+	}
+	token.UsedAt = &now
+	s.refreshTokens[tokenHash] = token
+	return token, nil
+}
+
+func (s *MemoryStore) RevokeRefreshTokenFamilyQuery(token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamilies(map[uuid.UUID]bool{token.FamilyID: true})
+	return nil
+}
+
+func (s *MemoryStore) RevokeTokenQuery(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiresAt.After(s.revoked[jti]) {
+		s.revoked[jti] = expiresAt
+	}
+
+	families := make(map[uuid.UUID]bool)
+	for _, token := range s.refreshTokens {
+		if token.AccessJTI == jti {
+			families[token.FamilyID] = true
+		}
+	}
+	s.revokeFamilies(families)
+
+	// the denylist only needs the tokens that could still be used
+	now := time.Now()
+	for id, expiry := range s.revoked {
+		if expiry.Before(now) {
+			delete(s.revoked, id)
+		}
+	}
+	return nil
+}
+
+// revokeFamilies revokes every refresh token of the families, the lock must be held
+func (s *MemoryStore) revokeFamilies(families map[uuid.UUID]bool) {
+	now := time.Now()
+	for hash, token := range s.refreshTokens {
+		if families[token.FamilyID] && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.refreshTokens[hash] = token
+		}
+	}
+}
+
+func (s *MemoryStore) IsTokenRevokedQuery(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+// matchesFilter reports whether a company passes the filters of a list
+func matchesFilter(company models.Company, filter models.CompanyFilter) bool {
+	if company.DeletedAt != nil && !filter.IncludeDeleted {
+		return false
+	}
+	if filter.Type != "" && company.Type != filter.Type {
+		return false
+	}
+	if filter.Registered != nil && company.Registered != *filter.Registered {
+		return false
+	}
+	if filter.MinEmployees != nil && company.Employees < *filter.MinEmployees {
+		return false
+	}
+	if filter.MaxEmployees != nil && company.Employees > *filter.MaxEmployees {
+		return false
+	}
+	if filter.NamePrefix != "" && !strings.HasPrefix(company.Name, filter.NamePrefix) {
+		return false
+	}
+	return true
+}
+
+// compareSortValue compares the sort field of a company with a value kept in a cursor,
+// decodeCursor has checked that the value parses
+func compareSortValue(company models.Company, field string, value string) int {
+	switch field {
+	case "employees":
+		v, _ := strconv.Atoi(value)
+		switch {
+		case company.Employees < v:
+			return -1
+		case company.Employees > v:
+			return 1
+		}
+		return 0
+	case "registered":
+		v, _ := strconv.ParseBool(value)
+		switch {
+		case company.Registered == v:
+			return 0
+		case v:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(sortValue(company, field), value)
+}
+
+func (s *MemoryStore) CreateWebhookQuery(webhook models.Webhook) (models.Webhook, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return webhook, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	webhook.ID = id
+	webhook.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[id] = webhook
+	return webhook, nil
+}
+
+func (s *MemoryStore) GetWebhookQuery(id uuid.UUID) (models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return webhook, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (s *MemoryStore) ListWebhooksQuery() ([]models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (s *MemoryStore) DeleteWebhookQuery(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+
+	kept := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.WebhookID != id {
+			kept = append(kept, d)
+		}
+	}
+	s.deliveries = kept
+	return nil
+}
+
+func (s *MemoryStore) EnqueueDeliveriesQuery(event models.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, apperror.Wrap(apperror.Internal, err, "Unable to encode the event")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enqueued := 0
+	now := time.Now()
+	for _, webhook := range s.webhooks {
+		if !subscribed(webhook, event.Type) || s.enqueued(webhook.ID, event.ID) {
+			continue
+		}
+		next := now
+		s.deliveries = append(s.deliveries, &memoryDelivery{
+			WebhookDelivery: models.WebhookDelivery{
+				ID:            uuid.New(),
+				WebhookID:     webhook.ID,
+				EventID:       event.ID,
+				EventType:     event.Type,
+				Status:        models.DeliveryPending,
+				NextAttemptAt: &next,
+				CreatedAt:     now,
+			},
+			payload: payload,
+		})
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// enqueued reports whether an event already has a delivery to a webhook, the lock must be held
+func (s *MemoryStore) enqueued(webhookID, eventID uuid.UUID) bool {
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ClaimDeliveriesQuery(limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*memoryDelivery
+	for _, d := range s.deliveries {
+		if d.Status == models.DeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]models.PendingDelivery, 0, len(due))
+	leased := now.Add(lease)
+	for _, d := range due {
+		d.NextAttemptAt = &leased
+		webhook := s.webhooks[d.WebhookID]
+		pending := models.PendingDelivery{
+			WebhookDelivery: d.WebhookDelivery,
+			URL:             webhook.URL,
+			Secret:          webhook.Secret,
+			Payload:         d.payload,
+		}
+		pending.Attempts = nil
+		claimed = append(claimed, pending)
+	}
+	return claimed, nil
+}
+
+func (s *MemoryStore) RecordDeliveryAttemptQuery(id uuid.UUID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.ID != id {
+			continue
+		}
+		d.Attempts = append([]models.DeliveryAttempt{attempt}, d.Attempts...)
+		d.AttemptCount = attempt.Attempt
+		d.Status = status
+		d.NextAttemptAt = next
+		d.LastError = attempt.Error
+		d.DeliveredAt = nil
+		if status == models.DeliveryDelivered {
+			now := time.Now()
+			d.DeliveredAt = &now
+		}
+		return nil
+	}
+	return ErrDeliveryNotFound
+}
+
+func (s *MemoryStore) ListDeliveriesQuery(webhookID uuid.UUID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := s.deliveries[i]
+		if d.WebhookID != webhookID || (status != "" && d.Status != status) {
+			continue
+		}
+		delivery := d.WebhookDelivery
+		delivery.Attempts = append([]models.DeliveryAttempt(nil), d.Attempts...)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) RedeliverQuery(webhookID, deliveryID uuid.UUID) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.ID != deliveryID || d.WebhookID != webhookID {
+			continue
+		}
+		now := time.Now()
+		d.Status = models.DeliveryPending
+		d.AttemptCount = 0
+		d.NextAttemptAt = &now
+		d.DeliveredAt = nil
+
+		delivery := d.WebhookDelivery
+		delivery.Attempts = nil
+		return delivery, nil
+	}
+	return models.WebhookDelivery{}, ErrDeliveryNotFound
+}
+
+func (s *MemoryStore) CreateJobQuery(job models.Job, input []byte) (models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return job, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	now := time.Now().UTC()
+	job.ID = id
+	job.Status = models.JobQueued
+	job.CreatedAt, job.UpdatedAt = now, now
+	s.jobs[id] = &memoryJob{Job: job, input: input}
+	return job, nil
+}
+
+func (s *MemoryStore) GetJobQuery(id uuid.UUID) (models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	return job.Job, nil
+}
+
+func (s *MemoryStore) CancelJobQuery(id uuid.UUID) (models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	if job.Status.Finished() {
+		return models.Job{}, ErrJobFinished
+	}
+	s.finishJob(job, models.JobCancelled)
+	return job.Job, nil
+}
+
+func (s *MemoryStore) ClaimJobQuery(lease time.Duration) (ClaimedJob, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var oldest *memoryJob
+	for _, job := range s.jobs {
+		waiting := job.Status == models.JobQueued || (job.Status == models.JobRunning && !job.leaseExpiresAt.After(now))
+		if waiting && (oldest == nil || job.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return ClaimedJob{}, false, nil
+	}
+
+	oldest.Status = models.JobRunning
+	oldest.lease = uuid.New()
+	oldest.leaseExpiresAt = now.Add(lease)
+	oldest.Attempts++
+	if oldest.StartedAt == nil {
+		oldest.StartedAt = &now
+	}
+	oldest.UpdatedAt = now
+	return ClaimedJob{
+		Job:   oldest.Job,
+		Lease: JobLease{JobID: oldest.ID, ID: oldest.lease, Duration: lease},
+		Input: oldest.input,
+	}, true, nil
+}
+
+func (s *MemoryStore) FinishJobQuery(lease JobLease, status models.JobStatus, report models.ImportReport, problem *apperror.Problem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.leasedJob(lease)
+	if err != nil {
+		return err
+	}
+	job.Report = report
+	job.Error = problem
+	s.finishJob(job, status)
+	return nil
+}
+
+func (s *MemoryStore) ReleaseJobQuery(lease JobLease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, err := s.leasedJob(lease); err == nil {
+		job.leaseExpiresAt = time.Now().UTC()
+		job.Attempts--
+	}
+	return nil
+}
+
+// leasedJob returns the running job of a lease, the lock must be held
+func (s *MemoryStore) leasedJob(lease JobLease) (*memoryJob, error) {
+	job, ok := s.jobs[lease.JobID]
+	if !ok || job.Status != models.JobRunning || job.lease != lease.ID {
+		return nil, ErrJobLeaseLost
+	}
+	return job, nil
+}
+
+// finishJob ends a job and drops its input and lease, the lock must be held
+func (s *MemoryStore) finishJob(job *memoryJob, status models.JobStatus) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.input = nil
+	job.lease = uuid.Nil
+	job.leaseExpiresAt = time.Time{}
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+}
+
+// saveCheckpoint saves the report of a job along with a batch and extends its lease, the lock must be held
+func (s *MemoryStore) saveCheckpoint(checkpoint *Checkpoint, results []OperationResult) error {
+	job, err := s.leasedJob(checkpoint.Lease)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	job.Report = checkpoint.Report(results)
+	job.leaseExpiresAt = now.Add(checkpoint.Lease.Duration)
+	job.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jain-chetan/companyservice/logger"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the advisory lock held while migrating,
+// so that instances starting together don't migrate twice
+const migrationLockID = 7291548310
+
+// Migration is one versioned change of the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		// files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+		file := entry.Name()
+		base := strings.TrimSuffix(file, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("unexpected migration file name %s", file)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == ".up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies and reverts the embedded migrations
+type Migrator struct {
+	db *sql.DB
+}
+
+// NewMigrator creates a migrator for the db of a connection pool
+func NewMigrator(db *sql.DB) *Migrator {
+	return &Migrator{db: db}
+}
+
+// Up applies every pending migration and returns the number applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	var count int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.Infof("Applied migration %04d_%s", migration.Version, migration.Name)
+			count++
+		}
+		return fillCanonicalNames(ctx, conn)
+	})
+	return count, err
+}
+
+// fillCanonicalNames sets the canonical name of the companies written before it had a column,
+// it is computed in Go so that it is the same as the one of the memory store
+func fillCanonicalNames(ctx context.Context, conn *sql.Conn) error {
+	filled := 0
+	for {
+		rows, err := conn.QueryContext(ctx, `SELECT id, name FROM company WHERE canonical_name IS NULL LIMIT 1000`)
+		if err != nil {
+			return fmt.Errorf("unable to read the names to canonicalize: %w", err)
+		}
+		names := make(map[string]string)
+		for rows.Next() {
+			var id, name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			names[id] = name
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			break
+		}
+
+		for id, name := range names {
+			if _, err := conn.ExecContext(ctx, `UPDATE company SET canonical_name = $2 WHERE id = $1`, id, CanonicalName(name)); err != nil {
+				return fmt.Errorf("unable to set the canonical name of the company %s: %w", id, err)
+			}
+		}
+		filled += len(names)
+	}
+	if filled > 0 {
+		logger.Infof("Set the canonical name of %d companies", filled)
+	}
+	return nil
+}
+
+// Down reverts the last steps applied migrations and returns the number reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var count int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %04d_%s can't be reverted, it has no down file", migration.Version, migration.Name)
+			}
+			err := inTx(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.Infof("Reverted migration %04d_%s", migration.Version, migration.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every migration with the time it was applied at
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			status := MigrationStatus{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs fn on a single connection holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("unable to take the migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			logger.Errorf("Unable to release the migration lock. %v", err)
+		}
+	}()
+
+	createTable := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("unable to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// appliedMigrations returns the time every applied migration was applied at, by version
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// inTx runs a migration script and records it in schema_migrations within one transaction
+func inTx(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
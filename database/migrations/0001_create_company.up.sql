@@ -0,0 +1,12 @@
+-- the table used to be created on the first insert, keep its shape so existing databases are adopted as is
+CREATE TABLE IF NOT EXISTS company (
+    id UUID,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    employees INT,
+    registered BOOL,
+    type TEXT
+);
+
+-- ids are generated by the service, the uuid-ossp extension is no longer needed
+ALTER TABLE company ALTER COLUMN id DROP DEFAULT;
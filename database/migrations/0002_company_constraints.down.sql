@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS company_name_pattern_idx;
+DROP INDEX IF EXISTS company_employees_idx;
+DROP INDEX IF EXISTS company_type_idx;
+
+ALTER TABLE company
+    DROP CONSTRAINT IF EXISTS company_employees_check,
+    DROP CONSTRAINT IF EXISTS company_name_key,
+    DROP CONSTRAINT IF EXISTS company_pkey,
+    ALTER COLUMN type DROP NOT NULL,
+    ALTER COLUMN registered DROP DEFAULT,
+    ALTER COLUMN registered DROP NOT NULL,
+    ALTER COLUMN employees DROP DEFAULT,
+    ALTER COLUMN employees DROP NOT NULL,
+    ALTER COLUMN description DROP DEFAULT;
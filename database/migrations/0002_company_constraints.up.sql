@@ -0,0 +1,34 @@
+UPDATE company SET employees = 0 WHERE employees IS NULL;
+UPDATE company SET registered = FALSE WHERE registered IS NULL;
+UPDATE company SET type = '' WHERE type IS NULL;
+
+-- a table of an earlier version may hold the same name twice, they are listed rather
+-- than left to the unique constraint, which names none of them
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('%L (%s times)', name, count), ', ' ORDER BY name) INTO duplicates
+    FROM (SELECT name, count(*) AS count FROM company GROUP BY name HAVING count(*) > 1) AS repeated;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'the company names % are used more than once, rename or delete the duplicates then migrate again', duplicates;
+    END IF;
+END
+$$;
+
+ALTER TABLE company
+    ALTER COLUMN id SET NOT NULL,
+    ALTER COLUMN description SET DEFAULT '',
+    ALTER COLUMN employees SET NOT NULL,
+    ALTER COLUMN employees SET DEFAULT 0,
+    ALTER COLUMN registered SET NOT NULL,
+    ALTER COLUMN registered SET DEFAULT FALSE,
+    ALTER COLUMN type SET NOT NULL,
+    ADD CONSTRAINT company_pkey PRIMARY KEY (id),
+    ADD CONSTRAINT company_name_key UNIQUE (name),
+    ADD CONSTRAINT company_employees_check CHECK (employees >= 0);
+
+-- the list endpoint filters on type and sorts on (field, id)
+CREATE INDEX company_type_idx ON company (type, id);
+CREATE INDEX company_employees_idx ON company (employees, id);
+CREATE INDEX company_name_pattern_idx ON company (name text_pattern_ops);
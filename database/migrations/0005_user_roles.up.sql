@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer',
+    ADD CONSTRAINT users_role_check CHECK (role IN ('viewer', 'editor', 'admin'));
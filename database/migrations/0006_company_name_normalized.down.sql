@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS company_name_normalized_key;
+ALTER TABLE company ADD CONSTRAINT company_name_key UNIQUE (name);
@@ -0,0 +1,22 @@
+-- the names that would break the index are listed, in groups of the same name
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(names, '; ' ORDER BY names) INTO duplicates
+    FROM (
+        SELECT string_agg(format('%L', name), ', ' ORDER BY name) AS names
+        FROM company
+        GROUP BY lower(btrim(regexp_replace(name, '\s+', ' ', 'g')))
+        HAVING count(*) > 1
+    ) AS repeated;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'the company names % differ only by case or spaces, rename or delete the duplicates then migrate again', duplicates;
+    END IF;
+END
+$$;
+
+-- names are unique regardless of case and of the spaces around and between words,
+-- the index is what makes two concurrent creates or renames to the same name conflict
+ALTER TABLE company DROP CONSTRAINT company_name_key;
+CREATE UNIQUE INDEX company_name_normalized_key ON company (lower(btrim(regexp_replace(name, '\s+', ' ', 'g'))));
@@ -0,0 +1,2 @@
+-- the version is incremented on every update, it is the ETag of the company
+ALTER TABLE company ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
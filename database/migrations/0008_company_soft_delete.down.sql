@@ -0,0 +1,18 @@
+-- the deleted companies would have to be removed for good, or come back with names
+-- that may be taken again, either is left to whoever runs the migration
+DO $$
+DECLARE
+    deleted BIGINT;
+BEGIN
+    SELECT count(*) INTO deleted FROM company WHERE deleted_at IS NOT NULL;
+    IF deleted > 0 THEN
+        RAISE EXCEPTION '% deleted companies are waiting to be purged, restore them or run DELETE FROM company WHERE deleted_at IS NOT NULL then migrate down again', deleted;
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS company_deleted_at_idx;
+DROP INDEX IF EXISTS company_name_normalized_key;
+CREATE UNIQUE INDEX company_name_normalized_key ON company (lower(btrim(regexp_replace(name, '\s+', ' ', 'g'))));
+
+ALTER TABLE company DROP COLUMN IF EXISTS deleted_at;
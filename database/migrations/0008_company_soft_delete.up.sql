@@ -0,0 +1,8 @@
+-- deleted companies are kept until they are purged, their names can be reused meanwhile
+ALTER TABLE company ADD COLUMN deleted_at TIMESTAMPTZ;
+
+DROP INDEX company_name_normalized_key;
+CREATE UNIQUE INDEX company_name_normalized_key ON company (lower(btrim(regexp_replace(name, '\s+', ' ', 'g')))) WHERE deleted_at IS NULL;
+
+-- the purge looks for the companies deleted before the retention period
+CREATE INDEX company_deleted_at_idx ON company (deleted_at) WHERE deleted_at IS NOT NULL;
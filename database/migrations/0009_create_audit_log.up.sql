@@ -0,0 +1,24 @@
+-- every change of a company with who made it, rows are never updated nor deleted
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    company_id UUID NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    subject TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_company_idx ON audit_log (company_id, id);
+CREATE INDEX audit_log_subject_idx ON audit_log (subject, id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
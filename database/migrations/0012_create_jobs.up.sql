@@ -0,0 +1,22 @@
+-- the background jobs, the input is kept until the job is finished so that a
+-- worker can resume it from its report after a restart
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    params JSONB NOT NULL DEFAULT '{}',
+    input BYTEA,
+    report JSONB NOT NULL DEFAULT '{}',
+    error JSONB,
+    attempts INT NOT NULL DEFAULT 0,
+    lease_id UUID,
+    lease_expires_at TIMESTAMPTZ,
+    created_by TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX jobs_unfinished_idx ON jobs (created_at) WHERE status IN ('queued', 'running');
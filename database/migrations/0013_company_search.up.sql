@@ -0,0 +1,19 @@
+-- the search matches the words of the name and description, ranked with the name first,
+-- and the names close to the query for typos
+-- pg_trgm is trusted from PostgreSQL 13, the owner of the database may create it, an
+-- older server or a role without the CREATE privilege needs it created beforehand
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN insufficient_privilege THEN
+    RAISE EXCEPTION 'the pg_trgm extension is missing and this role is not allowed to create it, run CREATE EXTENSION pg_trgm as a superuser then migrate again';
+END
+$$;
+
+ALTER TABLE company ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX company_search_idx ON company USING GIN (search);
+CREATE INDEX company_name_trgm_idx ON company USING GIN (name gin_trgm_ops);
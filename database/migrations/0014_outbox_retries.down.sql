@@ -0,0 +1,4 @@
+-- the parked events become pending again
+DROP INDEX IF EXISTS outbox_pending_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS parked_at, DROP COLUMN IF EXISTS next_attempt_at;
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
@@ -0,0 +1,9 @@
+-- the relay claims the events for a lease and publishes them outside of any transaction,
+-- a failed event is tried again at next_attempt_at and parked once out of attempts so
+-- that it doesn't hold back the events after it
+ALTER TABLE outbox
+    ADD COLUMN next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN parked_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL AND parked_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS company_canonical_name_missing_idx;
+DROP INDEX IF EXISTS company_canonical_name_trgm_idx;
+ALTER TABLE company DROP COLUMN IF EXISTS canonical_name;
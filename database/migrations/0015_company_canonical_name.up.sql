@@ -0,0 +1,7 @@
+-- the likely duplicates of a name are found by their canonical form, database.CanonicalName.
+-- The service writes it along with the name, the migrator fills it for the rows written
+-- before this migration or by an older version of the service.
+ALTER TABLE company ADD COLUMN canonical_name TEXT;
+
+CREATE INDEX company_canonical_name_trgm_idx ON company USING GIN (canonical_name gin_trgm_ops);
+CREATE INDEX company_canonical_name_missing_idx ON company (id) WHERE canonical_name IS NULL;
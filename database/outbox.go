@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// OutboxStore hands the events of the company changes to the relay, they are
+// written in the transaction of the changes so none is lost nor published for
+// a change rolled back
+type OutboxStore interface {
+	// ClaimEventsQuery returns the pending events due, oldest first, and keeps them from the
+	// other relays for the lease. They are published outside of any transaction.
+	ClaimEventsQuery(limit int, lease time.Duration) ([]models.PendingEvent, error)
+	// RecordEventAttemptQuery records an attempt to publish a claimed event: it is published
+	// when publishErr is empty, else it is tried again at next, or parked when next is nil
+	RecordEventAttemptQuery(eventID uuid.UUID, publishErr string, next *time.Time) error
+}
+
+// eventTypes gives the event published for every action of the audit log
+var eventTypes = map[models.AuditAction]models.EventType{
+	models.AuditCreate:  models.CompanyCreated,
+	models.AuditUpdate:  models.CompanyUpdated,
+	models.AuditDelete:  models.CompanyDeleted,
+	models.AuditRestore: models.CompanyRestored,
+}
+
+// newEvent builds the event of a change of a company
+func newEvent(actor models.Actor, action models.AuditAction, before, after *models.Company) models.Event {
+	company := after
+	if company == nil {
+		company = before
+	}
+	return models.Event{
+		ID:         uuid.New(),
+		Type:       eventTypes[action],
+		CompanyID:  company.ID,
+		Company:    company,
+		Subject:    actor.Subject,
+		RequestID:  actor.RequestID,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// writeEvent adds the event of a change of a company to the outbox, in the transaction of the change
+func writeEvent(tx *sql.Tx, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, err, "Unable to encode the event")
+	}
+
+	sqlStatement := `INSERT INTO outbox (event_id, type, company_id, payload) VALUES ($1, $2, $3, $4)`
+
+	// execute the sql statement
+	_, err = tx.Exec(sqlStatement, event.ID, event.Type, event.CompanyID, string(payload))
+	return queryError(err, nil)
+}
+
+// claim the pending events due, the lease keeps them from the other relays while they are
+// published and no row stays locked meanwhile
+func (s *PostgresStore) ClaimEventsQuery(limit int, lease time.Duration) ([]models.PendingEvent, error) {
+	sqlStatement := `UPDATE outbox SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox WHERE published_at IS NULL AND parked_at IS NULL AND next_attempt_at <= now()
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, payload, attempts`
+
+	// execute the sql statement
+	rows, err := s.db.Query(sqlStatement, limit, lease.Seconds())
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	events := []models.PendingEvent{}
+	for rows.Next() {
+		var id int64
+		var payload []byte
+		var event models.PendingEvent
+		if err := rows.Scan(&id, &payload, &event.Attempts); err != nil {
+			return nil, queryError(err, nil)
+		}
+		if err := json.Unmarshal(payload, &event.Event); err != nil {
+			return nil, apperror.Wrap(apperror.Internal, err, "Unable to decode the event %d of the outbox", id)
+		}
+		ids = append(ids, id)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(err, nil)
+	}
+
+	// RETURNING keeps no order, the events go out oldest first
+	sort.Sort(byOutboxID{ids, events})
+	return events, nil
+}
+
+// byOutboxID sorts the events claimed by their id in the outbox
+type byOutboxID struct {
+	ids    []int64
+	events []models.PendingEvent
+}
+
+func (b byOutboxID) Len() int           { return len(b.ids) }
+func (b byOutboxID) Less(i, j int) bool { return b.ids[i] < b.ids[j] }
+func (b byOutboxID) Swap(i, j int) {
+	b.ids[i], b.ids[j] = b.ids[j], b.ids[i]
+	b.events[i], b.events[j] = b.events[j], b.events[i]
+}
+
+// record an attempt to publish a claimed event
+func (s *PostgresStore) RecordEventAttemptQuery(eventID uuid.UUID, publishErr string, next *time.Time) error {
+	sqlStatement := `UPDATE outbox SET attempts = attempts + 1, last_error = $2,
+		published_at = CASE WHEN $2 = '' THEN now() END,
+		parked_at = CASE WHEN $2 <> '' AND $3::timestamptz IS NULL THEN now() END,
+		next_attempt_at = coalesce($3, now())
+		WHERE event_id = $1`
+
+	// execute the sql statement
+	res, err := s.db.Exec(sqlStatement, eventID, publishErr, next)
+	if err != nil {
+		return queryError(err, nil)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return queryError(err, nil)
+	}
+	if count == 0 {
+		return ErrEventNotFound
+	}
+	return nil
+}
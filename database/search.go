@@ -0,0 +1,264 @@
+package database
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+const (
+	// fuzzyThreshold is the word similarity from which a name matches a query with typos,
+	// the threshold of the pg_trgm <% operator
+	fuzzyThreshold = 0.6
+	// snippetWords is the number of words of the description kept in the highlights
+	snippetWords = 20
+	// the weights of the words matched in the name and in the description, the A and B weights of ts_rank
+	nameWeight        = 1.0
+	descriptionWeight = 0.4
+
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+	// headlineStart and headlineStop delimit the matches of ts_headline, characters of the
+	// private use area removed from the texts so that the markup is added once they are escaped
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+// searchWord is a lower-case word of a text searched, with its position in the text
+type searchWord struct {
+	text       string
+	start, end int
+}
+
+// searchWords splits a text into its words, the letters and digits between the other characters
+func searchWords(text string) []searchWord {
+	var words []searchWord
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			words = append(words, searchWord{text: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, searchWord{text: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return words
+}
+
+// searchTokens returns the words a query looks for
+func searchTokens(query string) []string {
+	words := searchWords(query)
+	tokens := make([]string, len(words))
+	for i, word := range words {
+		tokens[i] = word.text
+	}
+	return tokens
+}
+
+// prefixQuery is the tsquery of the documents with a word starting with every token,
+// the tokens only have letters and digits so none is an operator
+func prefixQuery(tokens []string) string {
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// matchesToken reports whether a word starts with one of the tokens
+func matchesToken(word string, tokens []string) bool {
+	for _, token := range tokens {
+		if strings.HasPrefix(word, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// trigrams returns the trigrams of the words of a text in order, every word padded
+// with two spaces before and one after like pg_trgm does
+func trigrams(words []searchWord) []string {
+	var grams []string
+	for _, word := range words {
+		padded := []rune("  " + word.text + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams = append(grams, string(padded[i:i+3]))
+		}
+	}
+	return grams
+}
+
+// wordSimilarity is the word_similarity of pg_trgm: the greatest similarity between the
+// trigrams of the query and those of a continuous extent of the trigrams of the text
+func wordSimilarity(query []searchWord, text []searchWord) float64 {
+	queryGrams := make(map[string]bool)
+	for _, gram := range trigrams(query) {
+		queryGrams[gram] = true
+	}
+	if len(queryGrams) == 0 {
+		return 0
+	}
+
+	textGrams := trigrams(text)
+	best := 0.0
+	for i := range textGrams {
+		extent := make(map[string]bool)
+		common := 0
+		for _, gram := range textGrams[i:] {
+			if extent[gram] {
+				continue
+			}
+			extent[gram] = true
+			if queryGrams[gram] {
+				common++
+			}
+			if similarity := float64(common) / float64(len(queryGrams)+len(extent)-common); similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
+
+// textRank ranks the words matched by the tokens, the name first. A company matches
+// only when every token starts a word of its name or description.
+func textRank(tokens []string, name, description []searchWord) (float64, bool) {
+	rank := 0.0
+	for _, token := range tokens {
+		switch {
+		case matchesWords(name, token):
+			rank += nameWeight
+		case matchesWords(description, token):
+			rank += descriptionWeight
+		default:
+			return 0, false
+		}
+	}
+	return rank / float64(len(tokens)), true
+}
+
+func matchesWords(words []searchWord, token string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word.text, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight marks the words of a text started by a token, the text is HTML escaped
+// so that the marks are the only markup
+func highlight(text string, tokens []string) string {
+	var b strings.Builder
+	last := 0
+	for _, word := range searchWords(text) {
+		if !matchesToken(word.text, tokens) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:word.start]))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(text[word.start:word.end]))
+		b.WriteString(highlightStop)
+		last = word.end
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// headlineMarks replaces the delimiters of ts_headline with the marks
+var headlineMarks = strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop)
+
+// markHeadline escapes a ts_headline and marks its matches
+func markHeadline(headline string) string {
+	return headlineMarks.Replace(html.EscapeString(headline))
+}
+
+// snippet returns the words of a description around its first match, highlighted
+func snippet(description string, tokens []string) string {
+	words := searchWords(description)
+	if len(words) <= snippetWords {
+		return highlight(description, tokens)
+	}
+	first := 0
+	for i, word := range words {
+		if matchesToken(word.text, tokens) {
+			first = i
+			break
+		}
+	}
+	start := first - snippetWords/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetWords
+	if end > len(words) {
+		end, start = len(words), len(words)-snippetWords
+	}
+	return highlight(description[words[start].start:words[end-1].end], tokens)
+}
+
+// sortSearchResults orders the results best match first, then by name
+func sortSearchResults(results []models.SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Company.Name != b.Company.Name {
+			return a.Company.Name < b.Company.Name
+		}
+		return a.Company.ID.String() < b.Company.ID.String()
+	})
+}
+
+// search the companies with a word starting with every token of the query, ranked by
+// ts_rank, and the companies whose name is close to the query for the typos
+func (s *PostgresStore) SearchCompaniesQuery(query string, limit int) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return results, nil
+	}
+
+	// the headlines are delimited by headlineStart and headlineStop, escaped and marked once read
+	sqlStatement := `WITH q AS (SELECT to_tsquery('english', $1) AS query)
+		SELECT ` + companyColumns + `,
+			ts_rank(search, q.query) + word_similarity($2, name) AS score,
+			ts_headline('english', translate(name, $4, ''), q.query, 'HighlightAll=true, ' || $5),
+			ts_headline('english', translate(description, $4, ''), q.query, 'MaxWords=20, MinWords=10, ' || $5)
+		FROM company, q
+		WHERE deleted_at IS NULL AND (search @@ q.query OR $2 <% name)
+		ORDER BY score DESC, name, id
+		LIMIT $3`
+	delimiters := `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `"`
+
+	// execute the sql statement
+	rows, err := s.db.Query(sqlStatement, prefixQuery(tokens), strings.Join(tokens, " "), limit, headlineStart+headlineStop, delimiters)
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.SearchResult
+		err := scanCompany(rows, &result.Company, &result.Score, &result.Highlights.Name, &result.Highlights.Description)
+		if err != nil {
+			return nil, queryError(err, nil)
+		}
+		result.Highlights.Name = markHeadline(result.Highlights.Name)
+		result.Highlights.Description = markHeadline(result.Highlights.Description)
+		if result.Company.Description == "" {
+			result.Highlights.Description = ""
+		}
+		results = append(results, result)
+	}
+	return results, queryError(rows.Err(), nil)
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"testing"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// searchStore returns a memory store with the companies
+func searchStore(t *testing.T, companies ...models.Company) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore()
+	for _, company := range companies {
+		if company.Type == "" {
+			company.Type = models.Corporation
+		}
+		if _, err := store.CreateCompanyQuery(models.Actor{}, company); err != nil {
+			t.Fatalf("create %s: %v", company.Name, err)
+		}
+	}
+	return store
+}
+
+func searchNames(t *testing.T, store *MemoryStore, query string) []string {
+	t.Helper()
+	results, err := store.SearchCompaniesQuery(query, 10)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	names := []string{}
+	for _, result := range results {
+		names = append(names, result.Company.Name)
+	}
+	return names
+}
+
+func TestSearchPrefixes(t *testing.T) {
+	store := searchStore(t,
+		models.Company{Name: "Acme Anvils", Description: "Anvils and rockets"},
+		models.Company{Name: "Globex", Description: "Power plants"},
+		models.Company{Name: "Initech", Description: "Software for banks"},
+	)
+
+	tests := map[string][]string{
+		"acm":           {"Acme Anvils"},
+		"ROCK":          {"Acme Anvils"},
+		"soft bank":     {"Initech"},
+		"soft rockets":  {},
+		"":              {},
+		"!!!":           {},
+		"plants power?": {"Globex"},
+	}
+	for query, want := range tests {
+		got := searchNames(t, store, query)
+		if len(got) != len(want) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%q: got %v, want %v", query, got, want)
+			}
+		}
+	}
+}
+
+func TestSearchTypos(t *testing.T) {
+	store := searchStore(t,
+		models.Company{Name: "Initech"},
+		models.Company{Name: "Umbrella Corporation"},
+	)
+
+	for query, want := range map[string]string{"Inittech": "Initech", "umbrela": "Umbrella Corporation"} {
+		got := searchNames(t, store, query)
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%q: got %v, want [%s]", query, got, want)
+		}
+	}
+	if got := searchNames(t, store, "Initrode"); len(got) != 0 {
+		t.Errorf("Initrode: got %v, want no match", got)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	store := searchStore(t,
+		models.Company{Name: "Blue Sky Airlines", Description: "Flights"},
+		models.Company{Name: "Acme", Description: "Sky diving lessons"},
+		models.Company{Name: "Sky", Description: "Satellite television"},
+		models.Company{Name: "Skyline Tours", Description: "Bus tours"},
+	)
+
+	// the names with the word first, by name, then the names with a word it starts,
+	// then the descriptions
+	got := searchNames(t, store, "sky")
+	want := []string{"Blue Sky Airlines", "Sky", "Skyline Tours", "Acme"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	results, err := store.SearchCompaniesQuery("sky", 2)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 2 || results[0].Score < results[1].Score {
+		t.Errorf("limit: got %+v, want the 2 best results", results)
+	}
+}
+
+func TestSearchHighlightsAreEscaped(t *testing.T) {
+	store := searchStore(t, models.Company{
+		Name:        "Acme & Sons",
+		Description: `Acme <img src=x onerror="alert(1)"> anvils`,
+	})
+
+	results, err := store.SearchCompaniesQuery("acme", 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	highlights := results[0].Highlights
+	if want := "<mark>Acme</mark> &amp; Sons"; highlights.Name != want {
+		t.Errorf("name: got %q, want %q", highlights.Name, want)
+	}
+	if want := "<mark>Acme</mark> &lt;img src=x onerror=&#34;alert(1)&#34;&gt; anvils"; highlights.Description != want {
+		t.Errorf("description: got %q, want %q", highlights.Description, want)
+	}
+
+	if got, want := markHeadline(headlineStart+"Acme"+headlineStop+" <b>"), "<mark>Acme</mark> &lt;b&gt;"; got != want {
+		t.Errorf("headline: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// MaxSimilarCompanies bounds the likely duplicates returned for a name
+const MaxSimilarCompanies = 10
+
+// legalSuffixes are the legal forms dropped from the end of a name before it is compared,
+// the dots are removed first so "L.L.C." is "llc"
+var legalSuffixes = map[string]bool{
+	"inc": true, "incorporated": true, "corp": true, "corporation": true,
+	"co": true, "company": true, "cos": true,
+	"llc": true, "llp": true, "lp": true, "ltd": true, "limited": true, "plc": true,
+	"gmbh": true, "ag": true, "sa": true, "sas": true, "sarl": true, "srl": true, "spa": true,
+	"bv": true, "nv": true, "oy": true, "ab": true, "pty": true, "pte": true,
+}
+
+// CanonicalName is the form of a company name its likely duplicates share: case folded,
+// without punctuation, without a leading "the" nor the legal forms at its end.
+// "ACME, Inc.", "Acme Incorporated" and "The Acme Co." are all "acme".
+func CanonicalName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, ".", ""))
+	name = strings.ReplaceAll(name, "&", " and ")
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	rest := words
+	if len(rest) > 1 && rest[0] == "the" {
+		rest = rest[1:]
+	}
+	end := len(rest)
+	for end > 0 && legalSuffixes[rest[end-1]] {
+		end--
+	}
+	// a name that is only legal forms, like "The Company", is kept as it is
+	if end == 0 {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(rest[:end], " ")
+}
+
+// maxNameDistance is the edit distance up to which two canonical names are the same
+// company, short names must match exactly
+func maxNameDistance(name string) int {
+	switch n := len([]rune(name)); {
+	case n <= 4:
+		return 0
+	case n <= 9:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the Levenshtein distance of two strings, in characters
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// similarCompanies keeps the companies whose canonical name is within the edit distance
+// of the canonical name given, closest first
+func similarCompanies(canonical string, companies []models.Company) []models.SimilarCompany {
+	limit := maxNameDistance(canonical)
+	similar := []models.SimilarCompany{}
+	for _, company := range companies {
+		if distance := editDistance(canonical, CanonicalName(company.Name)); distance <= limit {
+			similar = append(similar, models.SimilarCompany{ID: company.ID, Name: company.Name, Distance: distance})
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		if similar[i].Distance != similar[j].Distance {
+			return similar[i].Distance < similar[j].Distance
+		}
+		return similar[i].Name < similar[j].Name
+	})
+	if len(similar) > MaxSimilarCompanies {
+		similar = similar[:MaxSimilarCompanies]
+	}
+	return similar
+}
+
+// trigramThreshold is a lower bound of the trigram similarity of a canonical name to the
+// names within the edit distance of it, so that the trigram index misses none of them.
+// A name of n characters has about n+2 trigrams and an edit changes at most 3 of them.
+func trigramThreshold(canonical string, distance int) float64 {
+	trigrams := len([]rune(canonical)) + 2
+	edits := 3 * distance
+	if trigrams <= edits {
+		return 0
+	}
+	// the names share trigrams-edits of at most trigrams+edits each
+	return float64(trigrams-edits) / float64(trigrams+2*edits)
+}
+
+// find the likely duplicates of a name, the trigram index of the canonical names narrows
+// the companies down to the ones close enough before they are compared
+func (s *PostgresStore) SimilarCompaniesQuery(name string) ([]models.SimilarCompany, error) {
+	canonical := CanonicalName(name)
+	if canonical == "" {
+		return []models.SimilarCompany{}, nil
+	}
+	threshold := trigramThreshold(canonical, maxNameDistance(canonical))
+
+	var companies []models.Company
+	err := s.transact(func(tx *sql.Tx) error {
+		// the % operator compares with the threshold of the transaction
+		sqlStatement := `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`
+		if _, err := tx.Exec(sqlStatement, strconv.FormatFloat(threshold, 'f', -1, 64)); err != nil {
+			return queryError(err, nil)
+		}
+
+		sqlStatement = `SELECT ` + companyColumns + ` FROM company
+			WHERE deleted_at IS NULL AND canonical_name % $1
+			ORDER BY similarity(canonical_name, $1) DESC LIMIT 100`
+
+		// execute the sql statement
+		rows, err := tx.Query(sqlStatement, canonical)
+		if err != nil {
+			return queryError(err, nil)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var company models.Company
+			if err := scanCompany(rows, &company); err != nil {
+				return queryError(err, nil)
+			}
+			companies = append(companies, company)
+		}
+		return queryError(rows.Err(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return similarCompanies(canonical, companies), nil
+}
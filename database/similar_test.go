@@ -0,0 +1,166 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestCanonicalName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Acme", "acme"},
+		{"ACME, Inc.", "acme"},
+		{"Acme Incorporated", "acme"},
+		{"Acme Corp", "acme"},
+		{"Acme Ltd.", "acme"},
+		{"Acme GmbH", "acme"},
+		{"Acme L.L.C.", "acme"},
+		{"Acme, LLC", "acme"},
+		{"Acme Holdings Co. Ltd.", "acme holdings"},
+		{"The Acme Co.", "acme"},
+		{"the  acme", "acme"},
+		{"Theatre Company", "theatre"},
+		{"A & B", "a and b"},
+		{"A and B", "a and b"},
+		{"A&B Inc", "a and b"},
+		{"Company", "company"},
+		{"The Company", "the company"},
+		{"Inc. Ltd.", "inc ltd"},
+		{"Société Générale S.A.", "société générale"},
+		{"MÜLLER GmbH", "müller"},
+		{"Łódź Sp", "łódź sp"},
+		{"東京電力", "東京電力"},
+		{"7-Eleven, Inc.", "7 eleven"},
+		{"  ...  ", ""},
+	}
+	for _, test := range tests {
+		if got := CanonicalName(test.name); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"acme", "", 4},
+		{"", "acme", 4},
+		{"acme", "acme", 0},
+		{"acme", "acne", 1},
+		{"acme", "acmee", 1},
+		{"acme", "cme", 1},
+		{"acme", "macme", 1},
+		{"kitten", "sitting", 3},
+		{"northwind traders", "northwnd tradrs", 2},
+		// a character is a rune, not a byte
+		{"müller", "muller", 1},
+		{"société", "societe", 2},
+		{"東京電力", "東京電気", 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("%q, %q: got %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := editDistance(test.b, test.a); got != test.want {
+			t.Errorf("%q, %q: got %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestMaxNameDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"", 0},
+		{"ibm", 0},
+		{"acme", 0},
+		{"globe", 1},
+		{"müller", 1},
+		{"northwind", 1},
+		{"northwinds", 2},
+		{"northwind traders", 2},
+		// the characters are counted, "東京電力" is 4 of them
+		{"東京電力", 0},
+	}
+	for _, test := range tests {
+		if got := maxNameDistance(test.name); got != test.want {
+			t.Errorf("%q: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSimilarCompaniesRule(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"A and B Widgets", "A & B Widgets", true},
+		{"Acme Inc", "ACME, L.L.C.", true},
+		{"The Acme Co.", "Acme", true},
+		{"Northwind Traders", "Northwnd Tradrs Ltd", true},
+		{"Northwind Traders", "Northwnd Trdrs", false},
+		{"Globex", "Globez", true},
+		{"IBM", "IBN", false},
+		{"Müller GmbH", "Muller", true},
+	}
+	for _, test := range tests {
+		a, b := CanonicalName(test.a), CanonicalName(test.b)
+		if got := editDistance(a, b) <= maxNameDistance(a); got != test.want {
+			t.Errorf("%q, %q: got similar %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// trigramSimilarity is the similarity of pg_trgm: the trigrams shared over the trigrams of either
+func trigramSimilarity(a, b string) float64 {
+	gramsA, gramsB := make(map[string]bool), make(map[string]bool)
+	for _, gram := range trigrams(searchWords(a)) {
+		gramsA[gram] = true
+	}
+	for _, gram := range trigrams(searchWords(b)) {
+		gramsB[gram] = true
+	}
+	shared := 0
+	for gram := range gramsA {
+		if gramsB[gram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(gramsA)+len(gramsB)-shared)
+}
+
+func TestTrigramThresholdKeepsTheCandidates(t *testing.T) {
+	// the names within the edit distance of the canonical name, PostgreSQL must not filter them out
+	tests := []struct {
+		canonical, other string
+	}{
+		{"globe", "globes"},
+		{"globex", "glbex"},
+		{"northwind", "nortwind"},
+		{"northwind traders", "northwnd tradrs"},
+		{"northwind traders", "northwind trader x"},
+		{"a and b widgets", "a and b widgetz"},
+		{"initech systems", "initech sistem"},
+		{"société générale", "societe générale"},
+		{"international business machines", "internatonal busines machines"},
+	}
+	for _, test := range tests {
+		distance := maxNameDistance(test.canonical)
+		if d := editDistance(test.canonical, test.other); d > distance {
+			t.Fatalf("%q, %q: distance %d beyond %d, not a candidate", test.canonical, test.other, d, distance)
+		}
+		threshold := trigramThreshold(test.canonical, distance)
+		if similarity := trigramSimilarity(test.canonical, test.other); similarity < threshold {
+			t.Errorf("%q, %q: similarity %.3f below the threshold %.3f", test.canonical, test.other, similarity, threshold)
+		}
+	}
+
+	if got := trigramThreshold("acme", 0); got != 1 {
+		t.Errorf("exact match: got threshold %v, want 1", got)
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"time"
+
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// CompanyStore is the storage used by the handlers to keep the companies,
+// its errors are apperror domain errors. Every change is recorded in the
+// audit log along with the actor making it, and its event in the outbox,
+// atomically.
+type CompanyStore interface {
+	CreateCompanyQuery(actor models.Actor, company models.Company) (uuid.UUID, error)
+	GetCompanyQuery(id uuid.UUID) (models.Company, error)
+	ListCompaniesQuery(filter models.CompanyFilter) ([]models.Company, string, error)
+	ExportCompaniesQuery(filter models.CompanyFilter, fn func(company models.Company) error) error
+	// SearchCompaniesQuery returns the companies matching the words of a query or close to it, best match first
+	SearchCompaniesQuery(query string, limit int) ([]models.SearchResult, error)
+	// SimilarCompaniesQuery returns the companies whose name is likely the same as the one given, closest first
+	SimilarCompaniesQuery(name string) ([]models.SimilarCompany, error)
+	PatchCompanyQuery(actor models.Actor, id uuid.UUID, company models.Company) (models.Company, error)
+	DeleteCompanyQuery(actor models.Actor, id uuid.UUID, version int64) error
+	RestoreCompanyQuery(actor models.Actor, id uuid.UUID) (models.Company, error)
+	PurgeCompaniesQuery(deletedBefore time.Time) (int64, error)
+	// BatchCompaniesQuery applies the operations in order, in one transaction, and returns their results
+	BatchCompaniesQuery(actor models.Actor, ops []models.CompanyOperation, options BatchOptions) ([]OperationResult, error)
+}
+
+// Store is everything the service keeps
+type Store interface {
+	CompanyStore
+	AuditStore
+	OutboxStore
+	WebhookStore
+	JobStore
+	UserStore
+	TokenStore
+}
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// TokenStore keeps the refresh tokens and the denylist of revoked access tokens
+type TokenStore interface {
+	CreateRefreshTokenQuery(token models.RefreshToken) error
+	UseRefreshTokenQuery(tokenHash string) (models.RefreshToken, error)
+	RevokeRefreshTokenFamilyQuery(token models.RefreshToken) error
+	RevokeTokenQuery(jti string, expiresAt time.Time) error
+	IsTokenRevokedQuery(jti string) (bool, error)
+}
+
+func (s *PostgresStore) CreateRefreshTokenQuery(token models.RefreshToken) error {
+	sqlStatement := `INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, access_jti, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`
+
+	// execute the sql statement
+	_, err := s.db.Exec(sqlStatement, token.ID, token.UserID, token.FamilyID, token.TokenHash, token.AccessJTI, token.ExpiresAt)
+	return queryError(err, nil)
+}
+
+// UseRefreshTokenQuery marks a refresh token as used, it returns ErrRefreshTokenNotFound for an unknown
+// or expired token and ErrTokenReused with the token for one already used or revoked
+func (s *PostgresStore) UseRefreshTokenQuery(tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	// the update is atomic, of two concurrent refreshes with the same token only one succeeds
+	sqlStatement := `UPDATE refresh_tokens SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, family_id, token_hash, access_jti, expires_at, used_at, revoked_at`
+	err := scanRefreshToken(s.db.QueryRow(sqlStatement, tokenHash), &token)
+	if err != sql.ErrNoRows {
+		return token, queryError(err, nil)
+	}
+
+	sqlStatement = `SELECT id, user_id, family_id, token_hash, access_jti, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1 AND expires_at > now()`
+	err = scanRefreshToken(s.db.QueryRow(sqlStatement, tokenHash), &token)
+	if err != nil {
+		return token, queryError(err, ErrRefreshTokenNotFound)
+	}
+	return token, ErrTokenReused
+}
+
+func scanRefreshToken(row *sql.Row, token *models.RefreshToken) error {
+	return row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.AccessJTI, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+}
+
+// RevokeRefreshTokenFamilyQuery revokes a refresh token and every token rotated from the same login
+func (s *PostgresStore) RevokeRefreshTokenFamilyQuery(token models.RefreshToken) error {
+	sqlStatement := `UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`
+
+	// execute the sql statement
+	_, err := s.db.Exec(sqlStatement, token.FamilyID)
+	return queryError(err, nil)
+}
+
+// RevokeTokenQuery denies an access token until it expires, along with the refresh tokens issued with it
+func (s *PostgresStore) RevokeTokenQuery(jti string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return queryError(err, nil)
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO UPDATE SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)`
+	if _, err := tx.Exec(sqlStatement, jti, expiresAt); err != nil {
+		return queryError(err, nil)
+	}
+
+	sqlStatement = `UPDATE refresh_tokens SET revoked_at = now()
+		WHERE revoked_at IS NULL AND family_id IN (SELECT family_id FROM refresh_tokens WHERE access_jti = $1)`
+	if _, err := tx.Exec(sqlStatement, jti); err != nil {
+		return queryError(err, nil)
+	}
+
+	// the denylist only needs the tokens that could still be used
+	if _, err := tx.Exec(`DELETE FROM revoked_tokens WHERE expires_at < now()`); err != nil {
+		return queryError(err, nil)
+	}
+	return queryError(tx.Commit(), nil)
+}
+
+func (s *PostgresStore) IsTokenRevokedQuery(jti string) (bool, error) {
+	var revoked bool
+	sqlStatement := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	err := s.db.QueryRow(sqlStatement, jti).Scan(&revoked)
+	return revoked, queryError(err, nil)
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// UserStore is the storage of the user accounts
+type UserStore interface {
+	CreateUserQuery(user models.User) (models.User, error)
+	GetUserQuery(id uuid.UUID) (models.User, error)
+	GetUserByEmailQuery(email string) (models.User, error)
+	UpdateUserRoleQuery(id uuid.UUID, role models.Role) (models.User, error)
+}
+
+// create a user in the DB, the password hash must already be set
+func (s *PostgresStore) CreateUserQuery(user models.User) (models.User, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return user, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	user.ID = id
+	user.Password = ""
+
+	sqlStatement := `INSERT INTO users (id, email, password_hash, role) VALUES ($1, $2, $3, $4) RETURNING created_at`
+
+	// execute the sql statement
+	err = s.db.QueryRow(sqlStatement, user.ID, user.Email, user.PasswordHash, user.Role).Scan(&user.CreatedAt)
+	if isUniqueViolation(err) {
+		return user, ErrEmailTaken
+	}
+	if err != nil {
+		return user, queryError(err, nil)
+	}
+	return user, nil
+}
+
+// get one user from the DB by its id
+func (s *PostgresStore) GetUserQuery(id uuid.UUID) (models.User, error) {
+	var user models.User
+
+	sqlStatement := `SELECT id, email, password_hash, role, created_at FROM users WHERE id = $1`
+
+	// execute the sql statement
+	err := s.db.QueryRow(sqlStatement, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return user, queryError(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// get one user from the DB by its email, regardless of case
+func (s *PostgresStore) GetUserByEmailQuery(email string) (models.User, error) {
+	var user models.User
+
+	sqlStatement := `SELECT id, email, password_hash, role, created_at FROM users WHERE lower(email) = lower($1)`
+
+	// execute the sql statement
+	err := s.db.QueryRow(sqlStatement, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return user, queryError(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// change the role of a user in the DB
+func (s *PostgresStore) UpdateUserRoleQuery(id uuid.UUID, role models.Role) (models.User, error) {
+	var user models.User
+
+	sqlStatement := `UPDATE users SET role = $2 WHERE id = $1 RETURNING id, email, password_hash, role, created_at`
+
+	// execute the sql statement
+	err := s.db.QueryRow(sqlStatement, id, role).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return user, queryError(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// normalizeEmail is the key the in-memory store indexes the users by
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
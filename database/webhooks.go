@@ -0,0 +1,301 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// WebhookStore keeps the webhooks and the deliveries of the events to them
+type WebhookStore interface {
+	CreateWebhookQuery(webhook models.Webhook) (models.Webhook, error)
+	GetWebhookQuery(id uuid.UUID) (models.Webhook, error)
+	ListWebhooksQuery() ([]models.Webhook, error)
+	DeleteWebhookQuery(id uuid.UUID) error
+	// EnqueueDeliveriesQuery adds a delivery of the event to every webhook subscribed to its
+	// type, an event already enqueued for a webhook is skipped
+	EnqueueDeliveriesQuery(event models.Event) (int, error)
+	// ClaimDeliveriesQuery returns the pending deliveries due, oldest first, and keeps them
+	// from the other senders for the lease
+	ClaimDeliveriesQuery(limit int, lease time.Duration) ([]models.PendingDelivery, error)
+	// RecordDeliveryAttemptQuery adds an attempt to a delivery and moves it to its new
+	// status, next is when a pending delivery is tried again
+	RecordDeliveryAttemptQuery(id uuid.UUID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next *time.Time) error
+	ListDeliveriesQuery(webhookID uuid.UUID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error)
+	// RedeliverQuery makes a delivery pending again right away, with its attempts kept
+	RedeliverQuery(webhookID, deliveryID uuid.UUID) (models.WebhookDelivery, error)
+}
+
+// subscribed reports whether a webhook receives the events of a type
+func subscribed(webhook models.Webhook, eventType models.EventType) bool {
+	if len(webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range webhook.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// eventTypeStrings converts the event types for a TEXT[] column
+func eventTypeStrings(types []models.EventType) []string {
+	strs := make([]string, len(types))
+	for i, t := range types {
+		strs[i] = string(t)
+	}
+	return strs
+}
+
+// insert a webhook in the DB, the secret must already be set
+func (s *PostgresStore) CreateWebhookQuery(webhook models.Webhook) (models.Webhook, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return webhook, apperror.Wrap(apperror.Internal, err, "Unable to generate the id")
+	}
+	webhook.ID = id
+
+	sqlStatement := `INSERT INTO webhooks (id, url, event_types, secret, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+
+	// execute the sql statement
+	err = s.db.QueryRow(sqlStatement, webhook.ID, webhook.URL, pq.Array(eventTypeStrings(webhook.EventTypes)), webhook.Secret, webhook.CreatedBy).Scan(&webhook.CreatedAt)
+	return webhook, queryError(err, nil)
+}
+
+func scanWebhook(row rowScanner, webhook *models.Webhook) error {
+	var types []string
+	if err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&types), &webhook.Secret, &webhook.CreatedBy, &webhook.CreatedAt); err != nil {
+		return err
+	}
+	webhook.EventTypes = make([]models.EventType, len(types))
+	for i, t := range types {
+		webhook.EventTypes[i] = models.EventType(t)
+	}
+	return nil
+}
+
+// get a webhook with its secret
+func (s *PostgresStore) GetWebhookQuery(id uuid.UUID) (models.Webhook, error) {
+	var webhook models.Webhook
+	sqlStatement := `SELECT id, url, event_types, secret, created_by, created_at FROM webhooks WHERE id = $1`
+	err := scanWebhook(s.db.QueryRow(sqlStatement, id), &webhook)
+	return webhook, queryError(err, ErrWebhookNotFound)
+}
+
+// list the webhooks with their secrets, oldest first
+func (s *PostgresStore) ListWebhooksQuery() ([]models.Webhook, error) {
+	sqlStatement := `SELECT id, url, event_types, secret, created_by, created_at FROM webhooks ORDER BY created_at, id`
+
+	rows, err := s.db.Query(sqlStatement)
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, queryError(err, nil)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, queryError(rows.Err(), nil)
+}
+
+// delete a webhook along with its deliveries
+func (s *PostgresStore) DeleteWebhookQuery(id uuid.UUID) error {
+	sqlStatement := `DELETE FROM webhooks WHERE id = $1`
+
+	// execute the sql statement
+	res, err := s.db.Exec(sqlStatement, id)
+	if err != nil {
+		return queryError(err, nil)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return queryError(err, nil)
+	}
+	if count == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) EnqueueDeliveriesQuery(event models.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, apperror.Wrap(apperror.Internal, err, "Unable to encode the event")
+	}
+
+	enqueued := 0
+	err = s.transact(func(tx *sql.Tx) error {
+		sqlStatement := `SELECT id FROM webhooks WHERE cardinality(event_types) = 0 OR $1 = ANY(event_types)`
+
+		rows, err := tx.Query(sqlStatement, event.Type)
+		if err != nil {
+			return queryError(err, nil)
+		}
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return queryError(err, nil)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return queryError(err, nil)
+		}
+
+		sqlStatement = `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, now()) ON CONFLICT (webhook_id, event_id) DO NOTHING`
+		for _, id := range ids {
+			res, err := tx.Exec(sqlStatement, uuid.New(), id, event.ID, event.Type, string(payload))
+			if err != nil {
+				return queryError(err, nil)
+			}
+			if count, err := res.RowsAffected(); err == nil {
+				enqueued += int(count)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return enqueued, nil
+}
+
+// claim the deliveries due by moving their next attempt past the lease, a sender
+// stopped in the middle of a delivery leaves it to be tried again once the lease is over
+func (s *PostgresStore) ClaimDeliveriesQuery(limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	sqlStatement := `UPDATE webhook_deliveries AS d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM webhooks AS w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.status, d.attempt_count, d.last_error, d.created_at, w.url, w.secret, d.payload`
+
+	rows, err := s.db.Query(sqlStatement, limit, lease.Seconds())
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer rows.Close()
+
+	var deliveries []models.PendingDelivery
+	for rows.Next() {
+		var d models.PendingDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.AttemptCount, &d.LastError, &d.CreatedAt, &d.URL, &d.Secret, &d.Payload)
+		if err != nil {
+			return nil, queryError(err, nil)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, queryError(rows.Err(), nil)
+}
+
+func (s *PostgresStore) RecordDeliveryAttemptQuery(id uuid.UUID, attempt models.DeliveryAttempt, status models.DeliveryStatus, next *time.Time) error {
+	return s.transact(func(tx *sql.Tx) error {
+		sqlStatement := `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at) VALUES ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.Exec(sqlStatement, id, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMS, attempt.AttemptedAt); err != nil {
+			return queryError(err, nil)
+		}
+
+		sqlStatement = `UPDATE webhook_deliveries SET status = $2, attempt_count = $3, next_attempt_at = $4, last_error = $5,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+			WHERE id = $1`
+		res, err := tx.Exec(sqlStatement, id, status, attempt.Attempt, next, attempt.Error)
+		if err != nil {
+			return queryError(err, nil)
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return queryError(err, nil)
+		}
+		if count == 0 {
+			return ErrDeliveryNotFound
+		}
+		return nil
+	})
+}
+
+const deliveryColumns = "id, webhook_id, event_id, event_type, status, attempt_count, next_attempt_at, last_error, created_at, delivered_at"
+
+func scanDelivery(row rowScanner, d *models.WebhookDelivery) error {
+	return row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.AttemptCount, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+}
+
+// list the deliveries of a webhook with their attempts, newest first
+func (s *PostgresStore) ListDeliveriesQuery(webhookID uuid.UUID, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhookQuery(webhookID); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2) ORDER BY created_at DESC, id LIMIT $3`
+
+	rows, err := s.db.Query(sqlStatement, webhookID, status, limit)
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	byID := make(map[uuid.UUID]int)
+	var ids []string
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, queryError(err, nil)
+		}
+		byID[d.ID] = len(deliveries)
+		ids = append(ids, d.ID.String())
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(err, nil)
+	}
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	sqlStatement = `SELECT delivery_id, attempt, status_code, error, duration_ms, attempted_at FROM webhook_delivery_attempts
+		WHERE delivery_id = ANY($1::uuid[]) ORDER BY id DESC`
+
+	attemptRows, err := s.db.Query(sqlStatement, pq.Array(ids))
+	if err != nil {
+		return nil, queryError(err, nil)
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var deliveryID uuid.UUID
+		var a models.DeliveryAttempt
+		if err := attemptRows.Scan(&deliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, queryError(err, nil)
+		}
+		i := byID[deliveryID]
+		deliveries[i].Attempts = append(deliveries[i].Attempts, a)
+	}
+	return deliveries, queryError(attemptRows.Err(), nil)
+}
+
+func (s *PostgresStore) RedeliverQuery(webhookID, deliveryID uuid.UUID) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+
+	// the attempt count starts over so that the backoff does too
+	sqlStatement := `UPDATE webhook_deliveries SET status = 'pending', attempt_count = 0, next_attempt_at = now(), delivered_at = NULL
+		WHERE id = $1 AND webhook_id = $2 RETURNING ` + deliveryColumns
+	err := scanDelivery(s.db.QueryRow(sqlStatement, deliveryID, webhookID), &d)
+	return d, queryError(err, ErrDeliveryNotFound)
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Producer writes messages to a Kafka-compatible broker, it is implemented by a
+// thin adapter over the client in use (kafka-go, sarama, franz-go, Redpanda...)
+type Producer interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+}
+
+// KafkaSink writes the events to a topic keyed by company id, the events of a
+// company land in the same partition and keep their order
+type KafkaSink struct {
+	Producer Producer
+	Topic    string
+}
+
+func (s *KafkaSink) Publish(ctx context.Context, event models.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"event-id":   event.ID.String(),
+		"event-type": string(event.Type),
+	}
+	return s.Producer.Produce(ctx, s.Topic, []byte(event.CompanyID.String()), value, headers)
+}
+
+// Publisher publishes messages to NATS subjects, *nats.Conn implements it
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink publishes every event to the subject of its type under a prefix,
+// such as companies.CompanyCreated
+type NATSSink struct {
+	Conn   Publisher
+	Prefix string
+}
+
+func (s *NATSSink) Publish(ctx context.Context, event models.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.Conn.Publish(s.Prefix+"."+string(event.Type), data)
+}
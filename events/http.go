@@ -0,0 +1,54 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// HTTPSink posts every event as JSON to a URL, any status but 2xx is a failure
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink creates a sink posting the events to url with the client, http.DefaultClient when nil
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSink{URL: url, Client: client}
+}
+
+func (s *HTTPSink) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.ID.String())
+	req.Header.Set("X-Event-Type", string(event.Type))
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// drain the body so that the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", s.URL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// MemorySink keeps the events published in process, for the tests and the
+// consumers living in the service, it is safe for concurrent use
+type MemorySink struct {
+	mu          sync.Mutex
+	events      []models.Event
+	subscribers []chan<- models.Event
+}
+
+// NewMemorySink creates a sink keeping the events in memory
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Publish keeps the event and hands it to the subscribers, it fails when the
+// context is done before a subscriber receives it
+func (s *MemorySink) Publish(ctx context.Context, event models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Subscribe hands the events published from now on to ch, a slow receiver
+// holds back the publishing
+func (s *MemorySink) Subscribe(ch chan<- models.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, ch)
+}
+
+// Events returns the events published, oldest first
+func (s *MemorySink) Events() []models.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Event(nil), s.events...)
+}
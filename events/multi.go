@@ -0,0 +1,22 @@
+package events
+
+import (
+	"context"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Multi publishes every event to each of the sinks, a sink failing doesn't keep the event
+// from the others. The first error is returned and the event is published again to all,
+// so the sinks must tolerate duplicates.
+type Multi []Sink
+
+func (m Multi) Publish(ctx context.Context, event models.Event) error {
+	var first error
+	for _, sink := range m {
+		if err := sink.Publish(ctx, event); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
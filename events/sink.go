@@ -0,0 +1,28 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Sink publishes the events of the company changes to the other services.
+// An event is published at least once: it is sent again when Publish fails,
+// the consumers deduplicate on its id.
+type Sink interface {
+	Publish(ctx context.Context, event models.Event) error
+}
+
+// LogSink writes the events to the log, for the deployments without a broker
+type LogSink struct{}
+
+func (LogSink) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Event %s %s", event.Type, payload)
+	return nil
+}
@@ -0,0 +1,345 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MergePatchType is the media type of a JSON Merge Patch (RFC 7396)
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is the media type of a JSON Patch (RFC 6902)
+	JSONPatchType = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned when a test operation of a JSON Patch doesn't match
+var ErrTestFailed = errors.New("test operation failed")
+
+// MergePatch applies a JSON Merge Patch to a document, as per RFC 7396
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Operation is one operation of a JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	// HasValue reports whether the operation has a value member, a null value is one
+	HasValue bool `json:"-"`
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	// operation decodes the members without this method
+	type operation Operation
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, (*operation)(o)); err != nil {
+		return err
+	}
+	_, o.HasValue = members["value"]
+	return nil
+}
+
+// Apply applies a JSON Patch to a document, as per RFC 6902. The operations are
+// applied in order, the document is left unchanged when one of them fails.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("invalid json patch: %w", err)
+	}
+
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	for i, op := range operations {
+		var err error
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if !op.HasValue {
+			return nil, errors.New("missing value")
+		}
+		var v interface{}
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if isPrefix(from, path) && len(from) < len(path) {
+			return nil, errors.New("can't move a value into one of its children")
+		}
+		doc, v, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(v))
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, v) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses the index of an array token, "-" stands for the end of the array when allowed
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path and returns the document, which is replaced when the path is the root
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, path[:len(path)-1], node)
+	}
+	return nil, fmt.Errorf("path member %q has no parent object or array", last)
+}
+
+// remove deletes the value at path and returns the document and the value removed
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member %q not found", last)
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = replaceParent(doc, path[:len(path)-1], node)
+		return doc, v, err
+	}
+	return nil, nil, fmt.Errorf("path member %q not found", last)
+}
+
+// replaceParent stores an array whose length changed back into its parent
+func replaceParent(doc interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = array
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = array
+	}
+	return doc, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(node))
+		for k, child := range node {
+			c[k] = deepCopy(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(node))
+		for i, child := range node {
+			c[i] = deepCopy(child)
+		}
+		return c
+	}
+	return v
+}
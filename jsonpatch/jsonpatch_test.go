@@ -0,0 +1,180 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON reports whether two documents hold the same values, whatever the order of their members
+func equalJSON(t *testing.T, got, want []byte) bool {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestApply(t *testing.T) {
+	doc := `{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"add a member", `[{"op":"add","path":"/employees","value":7}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2,"employees":7}`},
+		{"add replaces a member", `[{"op":"add","path":"/name","value":"Globex"}]`,
+			`{"name":"Globex","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"add null", `[{"op":"add","path":"/description","value":null}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2,"description":null}`},
+		{"add in an array", `[{"op":"add","path":"/tags/1","value":"x"}]`,
+			`{"name":"Acme","tags":["a","x","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"add at the end of an array", `[{"op":"add","path":"/tags/-","value":"c"}]`,
+			`{"name":"Acme","tags":["a","b","c"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"add the root", `[{"op":"add","path":"","value":{"name":"Initech"}}]`,
+			`{"name":"Initech"}`},
+		{"remove a member", `[{"op":"remove","path":"/address"}]`,
+			`{"name":"Acme","tags":["a","b"],"a/b":1,"m~n":2}`},
+		{"remove from an array", `[{"op":"remove","path":"/tags/0"}]`,
+			`{"name":"Acme","tags":["b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"replace", `[{"op":"replace","path":"/address/city","value":"Bergen"}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Bergen"},"a/b":1,"m~n":2}`},
+		{"replace with null", `[{"op":"replace","path":"/address","value":null}]`,
+			`{"name":"Acme","tags":["a","b"],"address":null,"a/b":1,"m~n":2}`},
+		{"move", `[{"op":"move","from":"/address/city","path":"/city"}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{},"city":"Oslo","a/b":1,"m~n":2}`},
+		{"move in an array", `[{"op":"move","from":"/tags/0","path":"/tags/-"}]`,
+			`{"name":"Acme","tags":["b","a"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"copy", `[{"op":"copy","from":"/address","path":"/billing"}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"billing":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+		{"test", `[{"op":"test","path":"/tags","value":["a","b"]}]`,
+			doc},
+		{"test null", `[{"op":"add","path":"/description","value":null},{"op":"test","path":"/description","value":null}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1,"m~n":2,"description":null}`},
+		{"~1 escapes a slash", `[{"op":"replace","path":"/a~1b","value":3}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":3,"m~n":2}`},
+		{"~0 escapes a tilde", `[{"op":"remove","path":"/m~0n"}]`,
+			`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"},"a/b":1}`},
+		{"operations in order", `[{"op":"add","path":"/tags/-","value":"c"},{"op":"remove","path":"/tags/0"},{"op":"test","path":"/tags/1","value":"c"}]`,
+			`{"name":"Acme","tags":["b","c"],"address":{"city":"Oslo"},"a/b":1,"m~n":2}`},
+	}
+	for _, test := range tests {
+		got, err := Apply([]byte(doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equalJSON(t, got, []byte(test.want)) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	doc := `{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"}}`
+
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"missing value", `[{"op":"add","path":"/employees"}]`},
+		{"unknown op", `[{"op":"merge","path":"/name","value":"Globex"}]`},
+		{"invalid pointer", `[{"op":"add","path":"name","value":"Globex"}]`},
+		{"missing parent", `[{"op":"add","path":"/owner/name","value":"Globex"}]`},
+		{"index out of bounds", `[{"op":"add","path":"/tags/3","value":"c"}]`},
+		{"leading zero index", `[{"op":"replace","path":"/tags/01","value":"c"}]`},
+		{"remove the end of an array", `[{"op":"remove","path":"/tags/-"}]`},
+		{"remove a missing member", `[{"op":"remove","path":"/employees"}]`},
+		{"replace a missing member", `[{"op":"replace","path":"/employees","value":7}]`},
+		{"move into its own child", `[{"op":"move","from":"/address","path":"/address/previous"}]`},
+		{"copy a missing member", `[{"op":"copy","from":"/owner","path":"/billing"}]`},
+		{"not a patch", `{"op":"add","path":"/name","value":"Globex"}`},
+	}
+	for _, test := range tests {
+		if got, err := Apply([]byte(doc), []byte(test.patch)); err == nil {
+			t.Errorf("%s: got %s, want an error", test.name, got)
+		}
+	}
+}
+
+func TestApplyFailingTest(t *testing.T) {
+	_, err := Apply([]byte(`{"name":"Acme","employees":7}`), []byte(`[{"op":"test","path":"/employees","value":"7"}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("got %v, want %v", err, ErrTestFailed)
+	}
+	_, err = Apply([]byte(`{"name":"Acme","owner":"Ann"}`), []byte(`[{"op":"test","path":"/owner","value":null}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("test null: got %v, want %v", err, ErrTestFailed)
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"name":"Acme","tags":["a","b"],"address":{"city":"Oslo"}}`)
+	original := append([]byte(nil), doc...)
+
+	// the operations before the failing one are applied to the document decoded, never to doc
+	patch := `[{"op":"replace","path":"/name","value":"Globex"},{"op":"remove","path":"/tags/0"},{"op":"test","path":"/name","value":"Acme"}]`
+	got, err := Apply(doc, []byte(patch))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("got %v, want %v", err, ErrTestFailed)
+	}
+	if got != nil {
+		t.Errorf("got the document %s, want none", got)
+	}
+	if string(doc) != string(original) {
+		t.Errorf("the document changed to %s", doc)
+	}
+}
+
+func TestOperationValue(t *testing.T) {
+	tests := []struct {
+		operation string
+		hasValue  bool
+		value     string
+	}{
+		{`{"op":"add","path":"/a","value":1}`, true, "1"},
+		{`{"op":"add","path":"/a","value":null}`, true, "null"},
+		{`{"op":"remove","path":"/a"}`, false, ""},
+	}
+	for _, test := range tests {
+		var op Operation
+		if err := json.Unmarshal([]byte(test.operation), &op); err != nil {
+			t.Fatalf("%s: %v", test.operation, err)
+		}
+		if op.HasValue != test.hasValue || string(op.Value) != test.value {
+			t.Errorf("%s: got value %q (present %t), want %q (present %t)", test.operation, op.Value, op.HasValue, test.value, test.hasValue)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"set a member", `{"name":"Acme"}`, `{"employees":7}`, `{"name":"Acme","employees":7}`},
+		{"null removes a member", `{"name":"Acme","owner":"Ann"}`, `{"owner":null}`, `{"name":"Acme"}`},
+		{"nested objects merge", `{"address":{"city":"Oslo","zip":"0150"}}`, `{"address":{"city":"Bergen"}}`, `{"address":{"city":"Bergen","zip":"0150"}}`},
+		{"arrays are replaced", `{"tags":["a","b"]}`, `{"tags":["c"]}`, `{"tags":["c"]}`},
+		{"a value replaces the document", `{"name":"Acme"}`, `["a"]`, `["a"]`},
+	}
+	for _, test := range tests {
+		got, err := MergePatch([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equalJSON(t, got, []byte(test.want)) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
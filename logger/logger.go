@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[string]Level{
+	"debug": DebugLevel,
+	"info":  InfoLevel,
+	"warn":  WarnLevel,
+	"error": ErrorLevel,
+}
+
+var level = InfoLevel
+
+// ParseLevel converts the name of a level (debug, info, warn or error) to a Level
+func ParseLevel(name string) (Level, error) {
+	l, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// SetLevel discards the messages below the given level
+func SetLevel(l Level) {
+	level = l
+}
+
+func logf(l Level, prefix string, format string, v ...interface{}) {
+	if l < level {
+		return
+	}
+	log.Printf(prefix+format, v...)
+}
+
+func Debugf(format string, v ...interface{}) {
+	logf(DebugLevel, "DEBUG ", format, v...)
+}
+
+func Infof(format string, v ...interface{}) {
+	logf(InfoLevel, "INFO ", format, v...)
+}
+
+func Warnf(format string, v ...interface{}) {
+	logf(WarnLevel, "WARN ", format, v...)
+}
+
+func Errorf(format string, v ...interface{}) {
+	logf(ErrorLevel, "ERROR ", format, v...)
+}
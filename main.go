@@ -1,18 +1,289 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/jain-chetan/companyservice/auth"
+	"github.com/jain-chetan/companyservice/config"
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/events"
+	"github.com/jain-chetan/companyservice/logger"
+	middleware "github.com/jain-chetan/companyservice/middleware"
 	"github.com/jain-chetan/companyservice/router"
+	"github.com/jain-chetan/companyservice/webhook"
+	"github.com/jain-chetan/companyservice/worker"
 )
 
+const usage = `usage:
+  companyservice [flags]                       start the server
+  companyservice migrate [flags] up            apply the pending migrations
+  companyservice migrate [flags] down [steps]  revert the last steps migrations, 1 by default
+  companyservice migrate [flags] status        list the migrations and whether they are applied`
+
+// @title Company Service
+// @description A microservice to handle companies
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the access token
 func main() {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate(os.Args[2:])
+	} else {
+		err = serve(os.Args[1:])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// load reads the configuration and applies its log level
+func load(name string, args []string) (config.Config, []string, error) {
+	cfg, rest, err := config.Load(name, args)
+	if err != nil {
+		return cfg, nil, err
+	}
+	level, _ := logger.ParseLevel(cfg.LogLevel)
+	logger.SetLevel(level)
+	return cfg, rest, nil
+}
+
+func serve(args []string) error {
+
+	cfg, rest, err := load("companyservice", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %v\n%s", rest, usage)
+	}
+
+	var store database.Store
+	switch cfg.Store {
+	case "postgres":
+		db, err := database.Open(cfg.DB)
+		if err != nil {
+			return fmt.Errorf("unable to connect to the db: %w", err)
+		}
+		// close the db connection pool on shutdown
+		defer db.Close()
 
-	r := router.Router()
+		if cfg.AutoMigrate {
+			if _, err := database.NewMigrator(db).Up(context.Background()); err != nil {
+				return err
+			}
+		}
+		store = database.NewPostgresStore(db)
+	case "memory":
+		store = database.NewMemoryStore()
+	}
 
-	fmt.Println("Starting server on the port 8080...")
+	authenticator := auth.NewAuthenticator(auth.TokenConfig{
+		Secret:     cfg.TokenSecret,
+		Issuer:     cfg.TokenIssuer,
+		Audience:   cfg.TokenAudience,
+		TTL:        cfg.TokenTTL,
+		RefreshTTL: cfg.RefreshTTL,
+	}, store)
+
+	handler := middleware.NewHandler(store, authenticator, cfg.AdminEmails)
+	handler.MaxJobInput = int64(cfg.JobMaxInputBytes)
+	handler.WriteTimeout = cfg.Server.WriteTimeout
+	r := router.Router(handler)
+
+	// the background workers run until the server has shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var workers sync.WaitGroup
+	every := func(name string, interval time.Duration, fn func(ctx context.Context) error) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker.Every(ctx, name, interval, fn)
+		}()
+	}
+	every("purge of the deleted companies", cfg.PurgeInterval, worker.Purge(store, cfg.DeletedRetention))
+	// the relay also enqueues the deliveries of every event to the webhooks
+	sink := events.Multi{webhook.Sink{Store: store}, eventSink(cfg)}
+	relay := &worker.Relay{
+		Store:       store,
+		Sink:        sink,
+		MaxAttempts: cfg.EventMaxAttempts,
+		Backoff:     cfg.EventBackoff,
+		MaxBackoff:  cfg.EventMaxBackoff,
+		// the events of a batch are published one after the other
+		Lease:     time.Duration(cfg.EventBatchSize)*eventTimeout + time.Minute,
+		BatchSize: cfg.EventBatchSize,
+	}
+	every("relay of the events", cfg.EventRelayInterval, relay.Run)
+	sender := &webhook.Sender{
+		Store:       store,
+		Client:      webhook.NewClient(cfg.WebhookTimeout),
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Backoff:     cfg.WebhookBackoff,
+		MaxBackoff:  cfg.WebhookMaxBackoff,
+		BatchSize:   20,
+	}
+	every("delivery of the webhooks", cfg.WebhookInterval, sender.Run)
+	// the jobs left running by a previous start are resumed once their lease expires
+	jobs := &worker.Jobs{Store: store, Lease: cfg.JobLease, MaxAttempts: cfg.JobMaxAttempts}
+	for i := 1; i <= cfg.JobWorkers; i++ {
+		every(fmt.Sprintf("job worker %d", i), cfg.JobInterval, jobs.Run)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		// the exports move the write deadline of their connection
+		ConnContext: middleware.ConnContext,
+	}
+
+	// SIGTERM is how Kubernetes stops the pod, SIGINT is Ctrl-C
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Infof("Starting server on %s...", cfg.ListenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		// the server didn't start, like when the address is in use, the workers started are stopped all the same
+		if shutdownErr := shutdown(server, cancel, &workers, cfg.Server.ShutdownTimeout); shutdownErr != nil {
+			logger.Errorf("%v", shutdownErr)
+		}
+		return err
+	case <-signals.Done():
+	}
+	// a second signal stops the process right away
+	stop()
+
+	return shutdown(server, cancel, &workers, cfg.Server.ShutdownTimeout)
+}
+
+// shutdown stops accepting requests and waits for the ones in flight, then stops the
+// workers and waits for them, all within the timeout. The db pool is closed after it.
+func shutdown(server *http.Server, stopWorkers context.CancelFunc, workers *sync.WaitGroup, timeout time.Duration) error {
+	logger.Infof("Shutting down, the requests in flight and the workers have %v to finish", timeout)
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if err = server.Shutdown(deadline); err != nil {
+		// the connections left are cut, the requests on them fail
+		_ = server.Close()
+		err = fmt.Errorf("the requests in flight didn't finish in time: %w", err)
+	}
+
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-deadline.Done():
+		if err == nil {
+			err = fmt.Errorf("the workers didn't stop in time")
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("unclean shutdown: %w", err)
+	}
+	logger.Infof("Shut down")
+	return nil
+}
+
+// eventSink returns the sink the events are published to. The Kafka and NATS sinks
+// of the events package need a broker client the service doesn't depend on, so
+// events.sink doesn't offer them.
+// eventTimeout bounds the requests of the http sink
+const eventTimeout = 10 * time.Second
+
+func eventSink(cfg config.Config) events.Sink {
+	switch cfg.EventSink {
+	case "http":
+		return events.NewHTTPSink(cfg.EventHTTPURL, &http.Client{Timeout: eventTimeout})
+	default:
+		return events.LogSink{}
+	}
+}
+
+func migrate(args []string) error {
+
+	cfg, rest, err := load("companyservice migrate", args)
+	if err != nil {
+		return err
+	}
+	if cfg.Store != "postgres" {
+		return fmt.Errorf("migrations only apply to the postgres store")
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", usage)
+	}
+
+	db, err := database.Open(cfg.DB)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the db: %w", err)
+	}
+	defer db.Close()
+
+	return runMigrate(context.Background(), database.NewMigrator(db), rest)
+}
 
-	log.Fatal(http.ListenAndServe(":8080", r))
+func runMigrate(ctx context.Context, migrator *database.Migrator, args []string) error {
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", count)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+			steps = n
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migrations\n", count)
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %v\n%s", args, usage)
+	}
+	return nil
 }
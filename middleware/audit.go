@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// @Summary History of a company
+// @Description List the changes of a company, newest first, with the company before and after each of them
+// @Tags audit
+// @Produce json
+// @Param id path string true "Company ID"
+// @Param limit query int false "Page size"
+// @Param next query string false "Token of the next page"
+// @Success 200 {object} models.AuditList
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /companies/{id}/history [get]
+func (h *Handler) CompanyHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := companyID(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseAuditFilter(url.Values{"limit": query["limit"], "next": query["next"]})
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	filter.CompanyID = &id
+
+	h.listAudit(w, r, filter)
+}
+
+// @Summary Audit log
+// @Description List the changes of the companies, newest first, filtered by company, subject, action and time
+// @Tags audit
+// @Produce json
+// @Param company_id query string false "Company ID"
+// @Param subject query string false "Subject (user id) who made the changes"
+// @Param action query string false "create, update, delete or restore"
+// @Param since query string false "RFC 3339 time of the oldest change"
+// @Param until query string false "RFC 3339 time the changes were made before"
+// @Param limit query int false "Page size"
+// @Param next query string false "Token of the next page"
+// @Success 200 {object} models.AuditList
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /audit [get]
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	h.listAudit(w, r, filter)
+}
+
+func (h *Handler) listAudit(w http.ResponseWriter, r *http.Request, filter models.AuditFilter) {
+	entries, next, err := h.Store.ListAuditQuery(filter)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	res := models.AuditList{
+		Entries: entries,
+		Next:    next,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// parseAuditFilter reads the audit log filters from the query string
+func parseAuditFilter(query url.Values) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		Subject: query.Get("subject"),
+		Action:  models.AuditAction(query.Get("action")),
+		Cursor:  query.Get("next"),
+	}
+
+	switch filter.Action {
+	case "", models.AuditCreate, models.AuditUpdate, models.AuditDelete, models.AuditRestore:
+	default:
+		return filter, apperror.New(apperror.Validation, "invalid action %q", filter.Action)
+	}
+
+	if v := query.Get("company_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, apperror.New(apperror.Validation, "invalid company_id %q", v)
+		}
+		filter.CompanyID = &id
+	}
+	for name, field := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, apperror.New(apperror.Validation, "invalid %s %q, expected an RFC 3339 time", name, v)
+			}
+			*field = &t
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, apperror.New(apperror.Validation, "invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,204 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// subject returns the subject of a token, the user id the changes are recorded with
+func (ts *testServer) subject(token string) string {
+	ts.t.Helper()
+	claims, err := ts.auth.ValidateToken(token)
+	if err != nil {
+		ts.t.Fatalf("validate the token: %v", err)
+	}
+	return claims.Subject
+}
+
+// listAudit lists a page of the audit log as an admin
+func (ts *testServer) listAudit(path string) models.AuditList {
+	ts.t.Helper()
+	var list models.AuditList
+	ts.expect(request{method: "GET", path: path, role: models.RoleAdmin}, http.StatusOK, &list)
+	return list
+}
+
+// auditActions returns the actions of the entries in their order
+func auditActions(entries []models.AuditEntry) []models.AuditAction {
+	actions := make([]models.AuditAction, len(entries))
+	for i, entry := range entries {
+		actions[i] = entry.Action
+	}
+	return actions
+}
+
+func expectActions(t *testing.T, name string, entries []models.AuditEntry, want ...models.AuditAction) {
+	t.Helper()
+	got := auditActions(entries)
+	if len(got) != len(want) {
+		t.Errorf("%s: got the actions %v, want %v", name, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: got the actions %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestAuditRecordsEveryChange(t *testing.T) {
+	ts := newTestServer(t)
+	editor, admin := ts.subject(ts.tokens[models.RoleEditor]), ts.subject(ts.tokens[models.RoleAdmin])
+
+	var created models.CreateResponse
+	ts.expect(request{method: "POST", path: "/companies", role: models.RoleEditor, body: models.Company{Name: "Acme", Employees: 12, Type: models.Corporation},
+		headers: map[string]string{"X-Request-ID": "req-create"}}, http.StatusCreated, &created)
+	path := "/companies/" + created.ID.String()
+	ts.expect(request{method: "PATCH", path: path, role: models.RoleEditor, body: `{"employees": 15}`,
+		headers: map[string]string{"X-Request-ID": "req-update"}}, http.StatusOK, nil)
+	ts.expect(request{method: "DELETE", path: path, role: models.RoleAdmin,
+		headers: map[string]string{"X-Request-ID": "req-delete"}}, http.StatusOK, nil)
+	ts.expect(request{method: "POST", path: path + "/restore", role: models.RoleAdmin,
+		headers: map[string]string{"X-Request-ID": "req-restore"}}, http.StatusOK, nil)
+
+	// the history is newest first, every entry has who made the change, in which request
+	entries := ts.listAudit(path + "/history").Entries
+	expectActions(t, "history", entries, models.AuditRestore, models.AuditDelete, models.AuditUpdate, models.AuditCreate)
+	if len(entries) != 4 {
+		t.FailNow()
+	}
+	for i, want := range []struct{ subject, requestID string }{
+		{admin, "req-restore"}, {admin, "req-delete"}, {editor, "req-update"}, {editor, "req-create"},
+	} {
+		entry := entries[i]
+		if entry.CompanyID != created.ID || entry.Subject != want.subject || entry.RequestID != want.requestID || entry.CreatedAt.IsZero() {
+			t.Errorf("%s: got company %s, subject %q, request id %q at %v, want %s, %q and %q", entry.Action,
+				entry.CompanyID, entry.Subject, entry.RequestID, entry.CreatedAt, created.ID, want.subject, want.requestID)
+		}
+	}
+
+	restore, del, update, create := entries[0], entries[1], entries[2], entries[3]
+	if create.Before != nil || create.After == nil || create.After.Name != "Acme" || create.After.Employees != 12 {
+		t.Errorf("create: got before %+v and after %+v, want the new company after only", create.Before, create.After)
+	}
+	if update.Before == nil || update.After == nil || update.Before.Employees != 12 || update.After.Employees != 15 {
+		t.Errorf("update: got before %+v and after %+v, want 12 then 15 employees", update.Before, update.After)
+	}
+	if del.Before == nil || del.After != nil || del.Before.Employees != 15 || del.Before.DeletedAt != nil {
+		t.Errorf("delete: got before %+v and after %+v, want the company before only", del.Before, del.After)
+	}
+	if restore.Before == nil || restore.After == nil || restore.Before.DeletedAt == nil || restore.After.DeletedAt != nil {
+		t.Errorf("restore: got before %+v and after %+v, want the deleted company then the restored one", restore.Before, restore.After)
+	}
+
+	// the log is for the admins only
+	ts.expectProblem(request{method: "GET", path: path + "/history", role: models.RoleEditor}, http.StatusForbidden, "forbidden")
+	ts.expectProblem(request{method: "GET", path: "/audit", role: models.RoleEditor}, http.StatusForbidden, "forbidden")
+}
+
+func TestAuditFilters(t *testing.T) {
+	ts := newTestServer(t)
+	other := ts.createUser("other@example.com", models.RoleEditor)
+	editor, otherSubject := ts.subject(ts.tokens[models.RoleEditor]), ts.subject(other)
+
+	acme := ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+	time.Sleep(2 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	var created models.CreateResponse
+	ts.expect(request{method: "POST", path: "/companies", token: other, body: models.Company{Name: "Globex", Type: models.Corporation}}, http.StatusCreated, &created)
+	globex := created.ID
+	ts.expect(request{method: "PATCH", path: "/companies/" + acme.String(), token: other, body: `{"employees": 3}`}, http.StatusOK, nil)
+	time.Sleep(2 * time.Millisecond)
+	until := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	ts.expect(request{method: "DELETE", path: "/companies/" + globex.String(), role: models.RoleAdmin}, http.StatusOK, nil)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []models.AuditAction
+	}{
+		{"everything", url.Values{}, []models.AuditAction{models.AuditDelete, models.AuditUpdate, models.AuditCreate, models.AuditCreate}},
+		{"company", url.Values{"company_id": {acme.String()}}, []models.AuditAction{models.AuditUpdate, models.AuditCreate}},
+		{"subject", url.Values{"subject": {otherSubject}}, []models.AuditAction{models.AuditUpdate, models.AuditCreate}},
+		{"action", url.Values{"action": {"create"}}, []models.AuditAction{models.AuditCreate, models.AuditCreate}},
+		{"since", url.Values{"since": {since.Format(time.RFC3339Nano)}}, []models.AuditAction{models.AuditDelete, models.AuditUpdate, models.AuditCreate}},
+		{"until", url.Values{"until": {until.Format(time.RFC3339Nano)}}, []models.AuditAction{models.AuditUpdate, models.AuditCreate, models.AuditCreate}},
+		{"since and until", url.Values{"since": {since.Format(time.RFC3339Nano)}, "until": {until.Format(time.RFC3339Nano)}},
+			[]models.AuditAction{models.AuditUpdate, models.AuditCreate}},
+		{"subject and action", url.Values{"subject": {editor}, "action": {"create"}}, []models.AuditAction{models.AuditCreate}},
+		{"nothing matching", url.Values{"company_id": {uuid.NewString()}}, []models.AuditAction{}},
+	}
+	for _, test := range tests {
+		entries := ts.listAudit("/audit?" + test.query.Encode()).Entries
+		expectActions(t, test.name, entries, test.want...)
+	}
+
+	// the history of a company ignores the filters of the log
+	entries := ts.listAudit("/companies/" + acme.String() + "/history?action=update&subject=" + editor).Entries
+	expectActions(t, "history", entries, models.AuditUpdate, models.AuditCreate)
+
+	for _, query := range []string{"action=rename", "company_id=acme", "since=yesterday", "until=2024-01-01", "limit=0", "limit=ten", "next=abc"} {
+		ts.expectProblem(request{method: "GET", path: "/audit?" + query, role: models.RoleAdmin}, http.StatusBadRequest, "validation")
+	}
+}
+
+func TestAuditPagination(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+	for employees := 1; employees <= 4; employees++ {
+		ts.expect(request{method: "PUT", path: "/companies/" + id.String(), role: models.RoleEditor,
+			body: models.Company{Name: "Acme", Employees: employees, Type: models.Corporation}}, http.StatusOK, nil)
+	}
+	ts.createCompany(models.Company{Name: "Globex", Type: models.Corporation})
+
+	// the pages of the history follow each other without a gap or a repeat, the last one has no next
+	for _, path := range []string{"/companies/" + id.String() + "/history?", "/audit?company_id=" + id.String() + "&"} {
+		var ids []int64
+		var employees []int
+		next := ""
+		for pages := 0; ; pages++ {
+			if pages == 3 {
+				t.Fatalf("%s: more than 3 pages of 2 for 5 entries", path)
+			}
+			query := url.Values{"limit": {"2"}}
+			if next != "" {
+				query.Set("next", next)
+			}
+			list := ts.listAudit(path + query.Encode())
+			if len(list.Entries) > 2 {
+				t.Fatalf("%s: got a page of %d entries, want 2 at most", path, len(list.Entries))
+			}
+			for _, entry := range list.Entries {
+				ids = append(ids, entry.ID)
+				employees = append(employees, entry.After.Employees)
+			}
+			if next = list.Next; next == "" {
+				break
+			}
+		}
+
+		if len(ids) != 5 {
+			t.Fatalf("%s: got the entries %v, want 5", path, ids)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] >= ids[i-1] {
+				t.Errorf("%s: got the entries %v, want them newest first", path, ids)
+			}
+		}
+		for i, want := range []int{4, 3, 2, 1, 0} {
+			if employees[i] != want {
+				t.Errorf("%s: got the employees %v after the changes, want 4 down to 0", path, employees)
+				break
+			}
+		}
+	}
+}
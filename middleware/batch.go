@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/auth"
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
+
+	"github.com/google/uuid"
+)
+
+// MaxBatchOperations bounds the number of operations of a batch
+const MaxBatchOperations = 1000
+
+// @Summary Create, update and delete companies in a batch
+// @Description Apply an array of operations in one transaction. Atomic, the default, applies all of them or none; best_effort applies the ones that succeed. Every operation gets its result, in order: the id and version of the company or the problem it failed with.
+// @Tags company
+// @Accept json
+// @Produce json
+// @Param mode query string false "atomic or best_effort"
+// @Param operations body []models.CompanyOperation true "Operations, at most 1000"
+// @Success 200 {object} models.BatchResponse
+// @Success 207 {object} models.BatchResponse
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 412
+// @Router /companies:batch [post]
+func (h *Handler) BatchCompanies(w http.ResponseWriter, r *http.Request) {
+	mode := models.BatchMode(r.URL.Query().Get("mode"))
+	switch mode {
+	case "":
+		mode = models.BatchAtomic
+	case models.BatchAtomic, models.BatchBestEffort:
+	default:
+		apperror.Write(w, r, apperror.New(apperror.Validation, "mode must be %s or %s", models.BatchAtomic, models.BatchBestEffort))
+		return
+	}
+	atomic := mode == models.BatchAtomic
+
+	var ops []models.CompanyOperation
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ops); err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body, expected an array of operations: %v", err))
+		return
+	}
+	if len(ops) == 0 || len(ops) > MaxBatchOperations {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "A batch must have 1 to %d operations", MaxBatchOperations))
+		return
+	}
+
+	// deleting companies in a batch needs the same permission as DELETE
+	for _, op := range ops {
+		if op.Op == models.BatchDelete {
+			if err := auth.Check(w, r, auth.DeleteCompanies); err != nil {
+				apperror.Write(w, r, err)
+				return
+			}
+			break
+		}
+	}
+
+	results := make([]models.BatchResult, len(ops))
+	var valid []models.CompanyOperation
+	var indexes []int
+	for i, op := range ops {
+		results[i] = models.BatchResult{Index: i, Op: op.Op}
+		if err := checkOperation(op); err != nil {
+			setBatchError(&results[i], err)
+			continue
+		}
+		valid = append(valid, op)
+		indexes = append(indexes, i)
+	}
+
+	// an atomic batch with an invalid operation isn't tried at all
+	if len(valid) > 0 && (!atomic || len(valid) == len(ops)) {
+		outcomes, err := h.Store.BatchCompaniesQuery(actor(r), valid, database.BatchOptions{Atomic: atomic})
+		if err != nil {
+			apperror.Write(w, r, err)
+			return
+		}
+		for j, outcome := range outcomes {
+			result := &results[indexes[j]]
+			if outcome.Err != nil {
+				setBatchError(result, outcome.Err)
+				continue
+			}
+			id := outcome.Company.ID
+			result.ID = &id
+			result.Version = outcome.Company.Version
+			result.Status = http.StatusOK
+			if outcome.Created {
+				result.Status = http.StatusCreated
+			}
+		}
+	}
+
+	res := models.BatchResponse{Mode: mode, Results: results}
+	failedAt := -1
+	for i := range results {
+		if results[i].Error != nil && failedAt < 0 {
+			failedAt = i
+		}
+	}
+	if atomic && failedAt >= 0 {
+		// the operations before the failure were rolled back and the ones after it not tried
+		aborted := apperror.New(apperror.Aborted, "Not applied, operation %d of the atomic batch failed", failedAt)
+		for i := range results {
+			if results[i].Error == nil {
+				results[i] = models.BatchResult{Index: i, Op: results[i].Op}
+				setBatchError(&results[i], aborted)
+			}
+		}
+	}
+	for _, result := range results {
+		if result.Error == nil {
+			res.Succeeded++
+		} else {
+			res.Failed++
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case atomic && failedAt >= 0:
+		status = results[failedAt].Status
+	case res.Failed > 0:
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// checkOperation returns the validation error of an operation of a batch, before it is tried
+func checkOperation(op models.CompanyOperation) error {
+	switch op.Op {
+	case models.BatchCreate, models.BatchUpsert:
+		if op.Company == nil {
+			return apperror.New(apperror.Validation, "A %s needs the company", op.Op)
+		}
+		if op.ID != uuid.Nil || op.Company.ID != uuid.Nil {
+			return apperror.New(apperror.Validation, "A %s can't have an id, the company gets one when it is created", op.Op)
+		}
+	case models.BatchUpdate:
+		if op.ID == uuid.Nil || op.Company == nil {
+			return apperror.New(apperror.Validation, "An update needs the id and the company")
+		}
+		if op.Company.ID != uuid.Nil && op.Company.ID != op.ID {
+			return apperror.New(apperror.Validation, "The id of the company doesn't match the id of the operation")
+		}
+	case models.BatchDelete:
+		if op.ID == uuid.Nil {
+			return apperror.New(apperror.Validation, "A delete needs the id")
+		}
+		return nil
+	default:
+		return apperror.New(apperror.Validation, "op must be %s, %s, %s or %s", models.BatchCreate, models.BatchUpdate, models.BatchDelete, models.BatchUpsert)
+	}
+	return validation.Error(validation.Company(*op.Company))
+}
+
+// setBatchError makes an error the result of an operation of a batch, the internal errors are logged
+func setBatchError(result *models.BatchResult, err error) {
+	problem := apperror.ProblemOf(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Errorf("Operation %d of a batch failed. %v", result.Index, err)
+	}
+	result.Status = problem.Status
+	result.Error = &problem
+}
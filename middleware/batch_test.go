@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// auditCount returns the number of entries of the audit log
+func (ts *testServer) auditCount() int {
+	ts.t.Helper()
+	entries, _, err := ts.store.ListAuditQuery(models.AuditFilter{Limit: 1000})
+	if err != nil {
+		ts.t.Fatalf("list the audit log: %v", err)
+	}
+	return len(entries)
+}
+
+// getCompany returns a company of the store, ok is false when there is none
+func (ts *testServer) getCompany(id uuid.UUID) (models.Company, bool) {
+	ts.t.Helper()
+	var company models.Company
+	res, _ := ts.do(request{method: "GET", path: "/companies/" + id.String(), role: models.RoleViewer})
+	if res.StatusCode == http.StatusNotFound {
+		return company, false
+	}
+	ts.expect(request{method: "GET", path: "/companies/" + id.String(), role: models.RoleViewer}, http.StatusOK, &company)
+	return company, true
+}
+
+// expectResults fails unless the results of a batch have the statuses and the problem types
+func expectResults(t *testing.T, res models.BatchResponse, statuses []int, kinds []string) {
+	t.Helper()
+	if len(res.Results) != len(statuses) {
+		t.Fatalf("got %d results, want %d", len(res.Results), len(statuses))
+	}
+	for i, result := range res.Results {
+		if result.Index != i || result.Status != statuses[i] {
+			t.Errorf("result %d: got index %d and status %d, want status %d", i, result.Index, result.Status, statuses[i])
+		}
+		switch {
+		case kinds[i] == "" && result.Error != nil:
+			t.Errorf("result %d: got the problem %s, want none", i, result.Error.Type)
+		case kinds[i] != "" && (result.Error == nil || result.Error.Type != "urn:companyservice:problem:"+kinds[i]):
+			t.Errorf("result %d: got the problem %+v, want a %s problem", i, result.Error, kinds[i])
+		case kinds[i] == "" && result.ID == nil:
+			t.Errorf("result %d: got no id", i)
+		}
+	}
+}
+
+func TestBatchAtomicRollsBack(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Employees: 12, Type: models.Corporation})
+	audited := ts.auditCount()
+
+	// the third operation fails on the name of the first, the two before it are rolled back
+	var res models.BatchResponse
+	ts.expect(request{method: "POST", path: "/companies:batch", role: models.RoleEditor, body: []models.CompanyOperation{
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.Corporation}},
+		{Op: models.BatchUpdate, ID: id, Company: &models.Company{Name: "Acme", Employees: 99, Type: models.Corporation}},
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.NonProfit}},
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Initech", Type: models.Corporation}},
+	}}, http.StatusConflict, &res)
+	if res.Mode != models.BatchAtomic || res.Succeeded != 0 || res.Failed != 4 {
+		t.Errorf("got mode %s with %d succeeded and %d failed, want atomic with 4 failed", res.Mode, res.Succeeded, res.Failed)
+	}
+	expectResults(t, res,
+		[]int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency},
+		[]string{"aborted", "aborted", "conflict", "aborted"})
+	for _, i := range []int{0, 1, 3} {
+		if res.Results[i].ID != nil || res.Results[i].Version != 0 {
+			t.Errorf("result %d: got id %v and version %d of an operation rolled back", i, res.Results[i].ID, res.Results[i].Version)
+		}
+	}
+
+	if company, _ := ts.getCompany(id); company.Employees != 12 {
+		t.Errorf("got %d employees, want the update rolled back", company.Employees)
+	}
+	var list models.CompanyList
+	ts.expect(request{method: "GET", path: "/companies", role: models.RoleViewer}, http.StatusOK, &list)
+	if len(list.Companies) != 1 {
+		t.Errorf("got %d companies, want the creations rolled back", len(list.Companies))
+	}
+	if got := ts.auditCount(); got != audited {
+		t.Errorf("got %d audit entries, want the %d before the batch", got, audited)
+	}
+
+	// an invalid operation fails the batch before any is tried
+	res = models.BatchResponse{}
+	ts.expect(request{method: "POST", path: "/companies:batch?mode=atomic", role: models.RoleEditor, body: []models.CompanyOperation{
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.Corporation}},
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Initech", Type: "Guild"}},
+	}}, http.StatusBadRequest, &res)
+	expectResults(t, res, []int{http.StatusFailedDependency, http.StatusBadRequest}, []string{"aborted", "validation"})
+
+	// a batch applied in full answers 200
+	res = models.BatchResponse{}
+	ts.expect(request{method: "POST", path: "/companies:batch", role: models.RoleEditor, body: []models.CompanyOperation{
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.Corporation}},
+		{Op: models.BatchUpdate, ID: id, Version: 1, Company: &models.Company{Name: "Acme", Employees: 99, Type: models.Corporation}},
+	}}, http.StatusOK, &res)
+	expectResults(t, res, []int{http.StatusCreated, http.StatusOK}, []string{"", ""})
+	if res.Results[1].Version != 2 {
+		t.Errorf("got version %d of the update, want 2", res.Results[1].Version)
+	}
+	if got := ts.auditCount(); got != audited+2 {
+		t.Errorf("got %d audit entries, want %d", got, audited+2)
+	}
+}
+
+func TestBatchBestEffort(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Employees: 12, Type: models.Corporation})
+
+	// every operation failing rolls back to its savepoint alone, the update with a stale
+	// version leaves the company to the update after it
+	var res models.BatchResponse
+	ts.expect(request{method: "POST", path: "/companies:batch?mode=best_effort", role: models.RoleEditor, body: []models.CompanyOperation{
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.Corporation}},
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.NonProfit}},
+		{Op: models.BatchUpdate, ID: id, Version: 7, Company: &models.Company{Name: "Acme", Employees: 50, Type: models.Corporation}},
+		{Op: models.BatchUpdate, ID: id, Version: 1, Company: &models.Company{Name: "Acme", Employees: 99, Type: models.Corporation}},
+		{Op: models.BatchUpdate, ID: uuid.New(), Company: &models.Company{Name: "Initech", Type: models.Corporation}},
+		{Op: models.BatchCreate, Company: &models.Company{Name: "", Type: models.Corporation}},
+	}}, http.StatusMultiStatus, &res)
+	if res.Mode != models.BatchBestEffort || res.Succeeded != 2 || res.Failed != 4 {
+		t.Errorf("got mode %s with %d succeeded and %d failed, want best_effort with 2 and 4", res.Mode, res.Succeeded, res.Failed)
+	}
+	expectResults(t, res,
+		[]int{http.StatusCreated, http.StatusConflict, http.StatusPreconditionFailed, http.StatusOK, http.StatusNotFound, http.StatusBadRequest},
+		[]string{"", "conflict", "precondition-failed", "", "not-found", "validation"})
+
+	if company, _ := ts.getCompany(id); company.Employees != 99 {
+		t.Errorf("got %d employees, want the update after the failed one", company.Employees)
+	}
+	if company, ok := ts.getCompany(*res.Results[0].ID); !ok || company.Type != models.Corporation {
+		t.Errorf("got %+v, want the company of the first creation", company)
+	}
+
+	// a best effort batch applied in full answers 200
+	res = models.BatchResponse{}
+	ts.expect(request{method: "POST", path: "/companies:batch?mode=best_effort", role: models.RoleEditor, body: []models.CompanyOperation{
+		{Op: models.BatchUpsert, Company: &models.Company{Name: "Globex", Employees: 3, Type: models.Corporation}},
+	}}, http.StatusOK, &res)
+	expectResults(t, res, []int{http.StatusOK}, []string{""})
+
+	ts.expectProblem(request{method: "POST", path: "/companies:batch?mode=sometimes", role: models.RoleEditor,
+		body: []models.CompanyOperation{{Op: models.BatchDelete, ID: id}}}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "POST", path: "/companies:batch", role: models.RoleEditor, body: `[]`}, http.StatusBadRequest, "validation")
+}
+
+func TestBatchDeleteNeedsThePermission(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+	ops := []models.CompanyOperation{
+		{Op: models.BatchCreate, Company: &models.Company{Name: "Globex", Type: models.Corporation}},
+		{Op: models.BatchDelete, ID: id},
+	}
+
+	// an editor may not delete, even in a best effort batch, and nothing of it is applied
+	ts.expectProblem(request{method: "POST", path: "/companies:batch?mode=best_effort", role: models.RoleEditor, body: ops}, http.StatusForbidden, "forbidden")
+	ts.expectProblem(request{method: "POST", path: "/companies:batch", role: models.RoleViewer, body: ops[:1]}, http.StatusForbidden, "forbidden")
+	if _, ok := ts.getCompany(id); !ok {
+		t.Fatal("the company was deleted by an editor")
+	}
+	var list models.CompanyList
+	ts.expect(request{method: "GET", path: "/companies", role: models.RoleViewer}, http.StatusOK, &list)
+	if len(list.Companies) != 1 {
+		t.Errorf("got %d companies, want the creation of the forbidden batch left out", len(list.Companies))
+	}
+
+	var res models.BatchResponse
+	ts.expect(request{method: "POST", path: "/companies:batch", role: models.RoleAdmin, body: ops}, http.StatusOK, &res)
+	expectResults(t, res, []int{http.StatusCreated, http.StatusOK}, []string{"", ""})
+	if _, ok := ts.getCompany(id); ok {
+		t.Error("the company is still there after the delete of the admin")
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connKey struct{}
+
+// ConnContext keeps the connection of the requests in their context, for http.Server.ConnContext,
+// so that the handlers streaming long responses can move the write deadline of the server
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// extendWriteDeadline gives the response of a request another write timeout from now, or
+// no deadline without a write timeout. The server sets the deadline again for the next request.
+func (h *Handler) extendWriteDeadline(r *http.Request) {
+	conn, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	var deadline time.Time
+	if h.WriteTimeout > 0 {
+		deadline = time.Now().Add(h.WriteTimeout)
+	}
+	_ = conn.SetWriteDeadline(deadline)
+}
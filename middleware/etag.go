@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// etag is the entity tag of a version of a company
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// matchesETag reports whether an If-Match or If-None-Match header lists the tag of a version,
+// weak tags only match with the weak comparison of If-None-Match (RFC 7232)
+func matchesETag(header string, version int64, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[len("W/"):]
+		}
+		if tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch returns ErrVersionMismatch when the request has an If-Match header
+// that doesn't list the current version of the company
+func checkIfMatch(r *http.Request, current models.Company) error {
+	header := r.Header.Get("If-Match")
+	if header != "" && !matchesETag(header, current.Version, false) {
+		return database.ErrVersionMismatch
+	}
+	return nil
+}
+
+// conditionalVersion returns the version a change of the company must apply to, 0 for any version.
+// It is the current version when the request has an If-Match header, which is checked against it.
+func (h *Handler) conditionalVersion(r *http.Request, id uuid.UUID) (int64, error) {
+	if r.Header.Get("If-Match") == "" {
+		return 0, nil
+	}
+	current, err := h.Store.GetCompanyQuery(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		return 0, err
+	}
+	return current.Version, nil
+}
@@ -1,144 +1,164 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jain-chetan/companyservice/apperror"
 	"github.com/jain-chetan/companyservice/auth"
 	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/jsonpatch"
 	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+// Handler serves the endpoints from the store
+type Handler struct {
+	Store database.Store
+	Auth  *auth.Authenticator
+	// AdminEmails are given the admin role when they register, lower-cased
+	AdminEmails map[string]bool
+	// MaxJobInput bounds the file of an import job, in bytes
+	MaxJobInput int64
+	// WriteTimeout is the write timeout of the server, an export is given it again for every
+	// batch of companies it sends so that only a client that stops reading cuts it
+	WriteTimeout time.Duration
+}
+
+// NewHandler creates the handlers of the endpoints
+func NewHandler(store database.Store, authenticator *auth.Authenticator, adminEmails []string) *Handler {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[strings.ToLower(email)] = true
+	}
+	return &Handler{Store: store, Auth: authenticator, AdminEmails: admins, MaxJobInput: DefaultMaxJobInput}
+}
+
 func SwaggerHandler() http.Handler {
 	return httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/docs/swagger.json"), // Replace with your server URL
 	)
 }
 
-func CreateToken(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to decode the request body . %v", err)
-		return
-	}
-	token, err := auth.CreateToken(user)
-	if err != nil {
-		log.Printf("Unable to create token . %v", err)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(token)
-}
-
 // @Summary Create a new company
-// @Description Create a new company with the specified details
+// @Description Create a new company with the specified details. A name likely the same as the one of another company, once case, punctuation and legal forms are left out and allowing for typos, is a 409 listing the candidates, unless allow_similar is set: the company is then created with the candidates in similar and a Warning header.
 // @Tags company
 // @Accept json
 // @Produce json
 // @Param company body models.Company true "Company object that needs to be created"
-// @Success 201 {object} models.Company
+// @Param allow_similar query bool false "Create the company even when similar companies exist"
+// @Success 201 {object} models.CreateResponse
 // @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 409
 // @Router /companies [post]
-func CreateCompany(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateCompany(w http.ResponseWriter, r *http.Request) {
 
-	_, err := auth.ValidateToken(r.Header)
+	company, err := decodeCompany(r.Body)
 	if err != nil {
-		res := models.Response{
-			Code:    400,
-			Message: "Not a valid token",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
 		return
 	}
-	var company models.Company
 
-	err = json.NewDecoder(r.Body).Decode(&company)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to decode the request body . %v", err)
+	if err := validation.Error(validation.Company(company)); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	if company.Name == "" || company.Employees == 0 || company.Type == "" {
-		res := models.Response{
-			Code:    400,
-			Message: "Name, Employees, and Type are required fields",
+	allowSimilar := false
+	if v := r.URL.Query().Get("allow_similar"); v != "" {
+		if allowSimilar, err = strconv.ParseBool(v); err != nil {
+			apperror.Write(w, r, apperror.New(apperror.Validation, "invalid allow_similar %q", v))
+			return
 		}
-		w.WriteHeader(http.StatusBadRequest)
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
+	}
+	similar, err := h.Store.SimilarCompaniesQuery(company.Name)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if len(similar) > 0 && !allowSimilar && !sameName(similar, company.Name) {
+		apperror.Write(w, r, apperror.New(apperror.Conflict, "Similar companies exist, set allow_similar=true to create it anyway").With("candidates", similar))
 		return
 	}
 
-	unique, err := database.CheckNameUniqueness(company.Name)
+	// the name is unique by a constraint of the store, a duplicate is reported as a conflict
+	companyID, err := h.Store.CreateCompanyQuery(actor(r), company)
 	if err != nil {
-		log.Printf("Error: %v", err)
+		apperror.Write(w, r, err)
 		return
 	}
+	res := models.CreateResponse{
+		ID:      companyID,
+		Code:    201,
+		Message: "Company inserted",
+		Similar: similar,
+	}
+	if len(similar) > 0 {
+		w.Header().Set("Warning", `299 companyservice "Similar companies exist"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(1))
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
 
-	if unique == 0 {
-		companyID := database.CreateCompanyQuery(company)
-		res := models.CreateResponse{
-			ID:      companyID,
-			Code:    201,
-			Message: "Company inserted",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
-
-	} else {
-		res := models.Response{
-			Code:    400,
-			Message: "Name not unique",
+// sameName reports whether a similar company has the same name once normalized, the
+// store then refuses the name as not unique whatever allow_similar says
+func sameName(similar []models.SimilarCompany, name string) bool {
+	for _, company := range similar {
+		if database.NormalizeName(company.Name) == database.NormalizeName(name) {
+			return true
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
 	}
-
+	return false
 }
 
 // @Summary Get a company by ID
-// @Description Get a company by its ID
+// @Description Get a company by its ID, with its version in the ETag header
+// @Param If-None-Match header string false "ETag of the version held by the client"
 // @Tags company
 // @Accept json
 // @Produce json
 // @Param id path string true "Company ID"
 // @Success 200 {object} models.Company
+// @Success 304
 // @Failure 400
 // @Failure 404
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
 // @Router /companies/{id} [get]
-func GetCompany(w http.ResponseWriter, r *http.Request) {
-
-	params := mux.Vars(r)
+func (h *Handler) GetCompany(w http.ResponseWriter, r *http.Request) {
 
-	id, err := uuid.Parse(params["id"])
+	id, err := companyID(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to convert string to int . %v", err)
+		apperror.Write(w, r, err)
 		return
 	}
 
-	company, err := database.GetCompanyQuery(id)
-
+	company, err := h.Store.GetCompanyQuery(id)
 	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
 
-		res := models.Response{
-			Code:    404,
-			Message: "Company not found",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(res)
+	w.Header().Set("ETag", etag(company.Version))
+	if header := r.Header.Get("If-None-Match"); header != "" && matchesETag(header, company.Version, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -147,102 +167,336 @@ func GetCompany(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Update a company by ID
-// @Description Update a company with the specified details
+// @Description Update the fields of a company given in a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json), the other fields are kept
 // @Tags company
 // @Accept json
 // @Produce json
 // @Param id path string true "Company ID"
-// @Param company body models.Company true "Updated company object"
-// @Success 200
+// @Param If-Match header string false "ETag the company must still have"
+// @Param company body models.Company true "Fields of the company to update"
+// @Success 200 {object} models.Company
 // @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 412
+// @Failure 415
 // @Router /companies/{id} [patch]
-func PatchCompany(w http.ResponseWriter, r *http.Request) {
-	_, err := auth.ValidateToken(r.Header)
+func (h *Handler) PatchCompany(w http.ResponseWriter, r *http.Request) {
+	id, err := companyID(r)
 	if err != nil {
-		res := models.Response{
-			Code:    400,
-			Message: "Not a valid token",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
+		apperror.Write(w, r, err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case jsonpatch.MergePatchType, "application/json", "":
+		apply = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		apply = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		apperror.Write(w, r, apperror.WithStatus(apperror.Validation, http.StatusUnsupportedMediaType,
+			"Content-Type must be %s or %s", jsonpatch.MergePatchType, jsonpatch.JSONPatchType))
 		return
 	}
-	params := mux.Vars(r)
 
-	id, err := uuid.Parse(params["id"])
+	patch, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to convert string to int . %v", err)
+		apperror.Write(w, r, apperror.Wrap(apperror.Validation, err, "Unable to read the request body"))
+		return
 	}
 
-	var company models.Company
+	current, err := h.Store.GetCompanyQuery(id)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		apperror.Write(w, r, apperror.Wrap(apperror.Internal, err, "Unable to encode the company"))
+		return
+	}
+	doc, err = apply(doc, patch)
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Unable to apply the patch: %v", err))
+		return
+	}
+
+	company, err := decodeCompany(bytes.NewReader(doc))
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "The patched company is not valid: %v", err))
+		return
+	}
+	if company.ID != uuid.Nil && company.ID != id {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "The id of a company can't be changed"))
+		return
+	}
+	company.ID = id
+	// the patch was applied to the current version, it is lost if the company changed since
+	company.Version = current.Version
+
+	h.updateCompany(w, r, company)
+}
+
+// @Summary Replace a company by ID
+// @Description Replace every field of a company, the fields left out are reset
+// @Tags company
+// @Accept json
+// @Produce json
+// @Param id path string true "Company ID"
+// @Param If-Match header string false "ETag the company must still have"
+// @Param company body models.Company true "New company object"
+// @Success 200 {object} models.Company
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 412
+// @Router /companies/{id} [put]
+func (h *Handler) PutCompany(w http.ResponseWriter, r *http.Request) {
+	id, err := companyID(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	company, err := decodeCompany(r.Body)
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
+		return
+	}
+	if company.ID != uuid.Nil && company.ID != id {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "The id of the body doesn't match the id of the path"))
+		return
+	}
+	company.ID = id
 
-	err = json.NewDecoder(r.Body).Decode(&company)
+	company.Version, err = h.conditionalVersion(r, id)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to decode the request body.  %v", err)
+		apperror.Write(w, r, err)
+		return
 	}
 
-	_ = database.PatchCompanyQuery(id, company)
+	h.updateCompany(w, r, company)
+}
 
-	res := models.Response{
-		Code:    200,
-		Message: "Updated Successfully",
+// updateCompany validates and stores the new state of an existing company and sends it back
+func (h *Handler) updateCompany(w http.ResponseWriter, r *http.Request, company models.Company) {
+	if err := validation.Error(validation.Company(company)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	company, err := h.Store.PatchCompanyQuery(actor(r), company.ID, company)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(company.Version))
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(res)
+	_ = json.NewEncoder(w).Encode(company)
+}
+
+// decodeCompany decodes a company, refusing the fields models.Company doesn't have
+func decodeCompany(r io.Reader) (models.Company, error) {
+	var company models.Company
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&company)
+	return company, err
+}
+
+// companyID parses the id of the company of the request path
+func companyID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return id, apperror.New(apperror.Validation, "Invalid company id")
+	}
+	return id, nil
 }
 
 // @Summary Delete a company by ID
-// @Description Delete a company by its ID
+// @Description Delete a company by its ID, it can be restored until it is purged after the retention period
 // @Tags company
 // @Accept json
 // @Produce json
 // @Param id path string true "Company ID"
+// @Param If-Match header string false "ETag the company must still have"
 // @Success 200
 // @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 412
 // @Router /companies/{id} [delete]
-func DeleteCompany(w http.ResponseWriter, r *http.Request) {
-	_, err := auth.ValidateToken(r.Header)
+func (h *Handler) DeleteCompany(w http.ResponseWriter, r *http.Request) {
+	id, err := companyID(r)
 	if err != nil {
-		res := models.Response{
-			Code:    400,
-			Message: "Not a valid token",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(res)
+		apperror.Write(w, r, err)
+		return
+	}
+
+	version, err := h.conditionalVersion(r, id)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if err := h.Store.DeleteCompanyQuery(actor(r), id, version); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
-	params := mux.Vars(r)
-	id, err := uuid.Parse(params["id"])
+	writeResponse(w, http.StatusOK, "Deleted Successfully")
+}
 
+// @Summary Restore a deleted company
+// @Description Restore a company deleted less than the retention period ago
+// @Tags company
+// @Produce json
+// @Param id path string true "Company ID"
+// @Success 200 {object} models.Company
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Router /companies/{id}/restore [post]
+func (h *Handler) RestoreCompany(w http.ResponseWriter, r *http.Request) {
+	id, err := companyID(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Unable to convert the string into int.  %v", err)
+		apperror.Write(w, r, err)
 		return
 	}
-	_, err = database.GetCompanyQuery(id)
 
+	company, err := h.Store.RestoreCompanyQuery(actor(r), id)
 	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(company.Version))
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(company)
+}
 
-		res := models.Response{
-			Code:    404,
-			Message: "Company not found",
+// @Summary List companies
+// @Description List companies with optional filters, sorting and cursor based pagination
+// @Tags company
+// @Accept json
+// @Produce json
+// @Param type query string false "Company type"
+// @Param registered query bool false "Registered companies only"
+// @Param min_employees query int false "Minimum number of employees"
+// @Param max_employees query int false "Maximum number of employees"
+// @Param name_prefix query string false "Prefix of the company name"
+// @Param sort query string false "Field to sort on, prefixed with - for descending order"
+// @Param limit query int false "Page size"
+// @Param next query string false "Token of the next page"
+// @Param include_deleted query bool false "List the deleted companies too, admins only"
+// @Success 200 {object} models.CompanyList
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /companies [get]
+func (h *Handler) ListCompanies(w http.ResponseWriter, r *http.Request) {
+
+	filter, err := parseCompanyFilter(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if filter.IncludeDeleted {
+		if err := auth.Check(w, r, auth.ReadDeletedCompanies); err != nil {
+			apperror.Write(w, r, err)
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(res)
+	}
+
+	companies, next, err := h.Store.ListCompaniesQuery(filter)
+	if err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	_ = database.DeleteCompanyQuery(id)
-	res := models.Response{
-		Code:    200,
-		Message: "Deleted Successfully",
+	res := models.CompanyList{
+		Companies: companies,
+		Next:      next,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(res)
 }
+
+// parseCompanyFilter reads the list filters from the query string
+func parseCompanyFilter(query url.Values) (models.CompanyFilter, error) {
+	filter := models.CompanyFilter{
+		Type:       models.CompanyType(query.Get("type")),
+		NamePrefix: query.Get("name_prefix"),
+		Cursor:     query.Get("next"),
+	}
+
+	if filter.Type != "" && !validation.ValidCompanyType(filter.Type) {
+		return filter, apperror.New(apperror.Validation, "invalid type %q", filter.Type)
+	}
+	if v := query.Get("registered"); v != "" {
+		registered, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, apperror.New(apperror.Validation, "invalid registered %q", v)
+		}
+		filter.Registered = &registered
+	}
+	if v := query.Get("min_employees"); v != "" {
+		min, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, apperror.New(apperror.Validation, "invalid min_employees %q", v)
+		}
+		filter.MinEmployees = &min
+	}
+	if v := query.Get("max_employees"); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, apperror.New(apperror.Validation, "invalid max_employees %q", v)
+		}
+		filter.MaxEmployees = &max
+	}
+	if v := query.Get("include_deleted"); v != "" {
+		includeDeleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, apperror.New(apperror.Validation, "invalid include_deleted %q", v)
+		}
+		filter.IncludeDeleted = includeDeleted
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, apperror.New(apperror.Validation, "invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	sort := query.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		filter.Descending = true
+		sort = sort[1:]
+	}
+	filter.Sort = sort
+
+	return filter, nil
+}
@@ -0,0 +1,422 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jain-chetan/companyservice/auth"
+	database "github.com/jain-chetan/companyservice/database"
+	handlers "github.com/jain-chetan/companyservice/middleware"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/router"
+
+	"github.com/google/uuid"
+)
+
+// testServer serves the routes from a memory store, with a token for a user of every role
+type testServer struct {
+	t      *testing.T
+	url    string
+	store  *database.MemoryStore
+	auth   *auth.Authenticator
+	tokens map[models.Role]string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return startTestServer(t, func(*handlers.Handler, *http.Server) {})
+}
+
+// startTestServer starts a test server once configure has set its handler and server up
+func startTestServer(t *testing.T, configure func(h *handlers.Handler, s *http.Server)) *testServer {
+	t.Helper()
+	store := database.NewMemoryStore()
+	authenticator := auth.NewAuthenticator(auth.TokenConfig{
+		Secret:     "test-secret",
+		Issuer:     "companyservice",
+		Audience:   "companyservice",
+		TTL:        time.Hour,
+		RefreshTTL: time.Hour,
+	}, store)
+	handler := handlers.NewHandler(store, authenticator, nil)
+	server := httptest.NewUnstartedServer(router.Router(handler))
+	configure(handler, server.Config)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	ts := &testServer{t: t, url: server.URL, store: store, auth: authenticator, tokens: map[models.Role]string{}}
+	for _, role := range []models.Role{models.RoleViewer, models.RoleEditor, models.RoleAdmin} {
+		ts.tokens[role] = ts.createUser(string(role)+"@example.com", role)
+	}
+	return ts
+}
+
+// createUser creates a user and returns its access token
+func (ts *testServer) createUser(email string, role models.Role) string {
+	ts.t.Helper()
+	user, err := ts.store.CreateUserQuery(models.User{Email: email, Role: role})
+	if err != nil {
+		ts.t.Fatalf("create the user %s: %v", email, err)
+	}
+	token, err := ts.auth.CreateToken(user)
+	if err != nil {
+		ts.t.Fatalf("create the token of %s: %v", email, err)
+	}
+	return token.AccessToken
+}
+
+// request is a request to the test server, sent with its token or else the one of its role
+type request struct {
+	method  string
+	path    string
+	role    models.Role
+	token   string
+	body    interface{}
+	headers map[string]string
+}
+
+// do sends a request and returns its response with the body read
+func (ts *testServer) do(req request) (*http.Response, []byte) {
+	ts.t.Helper()
+	var body io.Reader
+	switch b := req.body.(type) {
+	case nil:
+	case string:
+		body = bytes.NewBufferString(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatalf("encode the body: %v", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	r, err := http.NewRequest(req.method, ts.url+req.path, body)
+	if err != nil {
+		ts.t.Fatalf("create the request: %v", err)
+	}
+	switch {
+	case req.token != "":
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	case req.role != "":
+		r.Header.Set("Authorization", "Bearer "+ts.tokens[req.role])
+	}
+	for k, v := range req.headers {
+		r.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		ts.t.Fatalf("%s %s: %v", req.method, req.path, err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		ts.t.Fatalf("read the response of %s %s: %v", req.method, req.path, err)
+	}
+	return res, b
+}
+
+// expect sends a request and fails unless it is answered with the status, the body is decoded into v
+func (ts *testServer) expect(req request, status int, v interface{}) *http.Response {
+	ts.t.Helper()
+	res, body := ts.do(req)
+	if res.StatusCode != status {
+		ts.t.Fatalf("%s %s: got status %d, want %d: %s", req.method, req.path, res.StatusCode, status, body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			ts.t.Fatalf("%s %s: decode the response: %v: %s", req.method, req.path, err, body)
+		}
+	}
+	return res
+}
+
+// problem is the body of an error response
+type problem struct {
+	Type       string              `json:"type"`
+	Status     int                 `json:"status"`
+	Detail     string              `json:"detail"`
+	Instance   string              `json:"instance"`
+	Reason     string              `json:"reason"`
+	Errors     []models.FieldError `json:"errors"`
+	Candidates []json.RawMessage   `json:"candidates"`
+}
+
+// expectProblem sends a request and fails unless it is answered with a problem of the kind
+func (ts *testServer) expectProblem(req request, status int, kind string) problem {
+	ts.t.Helper()
+	var p problem
+	res := ts.expect(req, status, &p)
+	if ct := res.Header.Get("Content-Type"); ct != "application/problem+json" {
+		ts.t.Errorf("%s %s: got Content-Type %q, want application/problem+json", req.method, req.path, ct)
+	}
+	if want := "urn:companyservice:problem:" + kind; p.Type != want {
+		ts.t.Errorf("%s %s: got problem type %q, want %q", req.method, req.path, p.Type, want)
+	}
+	if p.Status != status {
+		ts.t.Errorf("%s %s: got problem status %d, want %d", req.method, req.path, p.Status, status)
+	}
+	return p
+}
+
+// createCompany creates a company as an editor and returns its id
+func (ts *testServer) createCompany(company models.Company) uuid.UUID {
+	ts.t.Helper()
+	var created models.CreateResponse
+	ts.expect(request{method: "POST", path: "/companies", role: models.RoleEditor, body: company}, http.StatusCreated, &created)
+	return created.ID
+}
+
+func TestCreateAndGetCompany(t *testing.T) {
+	ts := newTestServer(t)
+
+	var created models.CreateResponse
+	res := ts.expect(request{method: "POST", path: "/companies", role: models.RoleEditor, body: models.Company{
+		Name: "Acme", Description: "Anvils", Employees: 12, Registered: true, Type: models.Corporation,
+	}}, http.StatusCreated, &created)
+	if created.ID == uuid.Nil {
+		t.Fatal("create: no id in the response")
+	}
+	if etag := res.Header.Get("ETag"); etag != `"1"` {
+		t.Errorf("create: got ETag %q, want \"1\"", etag)
+	}
+
+	var company models.Company
+	res = ts.expect(request{method: "GET", path: "/companies/" + created.ID.String(), role: models.RoleViewer}, http.StatusOK, &company)
+	want := models.Company{ID: created.ID, Name: "Acme", Description: "Anvils", Employees: 12, Registered: true, Type: models.Corporation}
+	if company != want {
+		t.Errorf("get: got %+v, want %+v", company, want)
+	}
+
+	ts.expect(request{method: "GET", path: "/companies/" + created.ID.String(), role: models.RoleViewer,
+		headers: map[string]string{"If-None-Match": res.Header.Get("ETag")}}, http.StatusNotModified, nil)
+}
+
+func TestCreateCompanyProblems(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+
+	p := ts.expectProblem(request{method: "POST", path: "/companies", role: models.RoleEditor,
+		body: models.Company{Name: " Globex", Employees: -1, Type: "Guild"}}, http.StatusBadRequest, "validation")
+	codes := map[string]string{}
+	for _, e := range p.Errors {
+		codes[e.Field] = e.Code
+	}
+	want := map[string]string{"name": "surrounding_whitespace", "employees": "negative", "type": "not_allowed"}
+	for field, code := range want {
+		if codes[field] != code {
+			t.Errorf("validation: got code %q for %s, want %q in %+v", codes[field], field, code, p.Errors)
+		}
+	}
+
+	ts.expectProblem(request{method: "POST", path: "/companies", role: models.RoleEditor,
+		body: `{"name": "Initech", "type": "Corporation"`}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "POST", path: "/companies", role: models.RoleEditor,
+		body: `{"name": "Initech", "type": "Corporation", "employes": 3}`}, http.StatusBadRequest, "validation")
+
+	ts.expectProblem(request{method: "POST", path: "/companies", role: models.RoleEditor,
+		body: models.Company{Name: "ACME", Type: models.NonProfit}}, http.StatusConflict, "conflict")
+
+	p = ts.expectProblem(request{method: "POST", path: "/companies", role: models.RoleEditor,
+		body: models.Company{Name: "Acme Inc.", Type: models.Corporation}}, http.StatusConflict, "conflict")
+	if len(p.Candidates) != 1 {
+		t.Errorf("similar: got %d candidates, want 1", len(p.Candidates))
+	}
+
+	var created models.CreateResponse
+	res := ts.expect(request{method: "POST", path: "/companies?allow_similar=true", role: models.RoleEditor,
+		body: models.Company{Name: "Acme Inc.", Type: models.Corporation}}, http.StatusCreated, &created)
+	if len(created.Similar) != 1 || res.Header.Get("Warning") == "" {
+		t.Errorf("allow_similar: got similar %+v and Warning %q, want the candidate and a warning", created.Similar, res.Header.Get("Warning"))
+	}
+}
+
+func TestGetCompanyProblems(t *testing.T) {
+	ts := newTestServer(t)
+
+	p := ts.expectProblem(request{method: "GET", path: "/companies/" + uuid.NewString(), role: models.RoleViewer}, http.StatusNotFound, "not-found")
+	if p.Instance == "" {
+		t.Error("not found: the problem has no instance")
+	}
+	ts.expectProblem(request{method: "GET", path: "/companies/not-an-id", role: models.RoleViewer}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "GET", path: "/companies/" + uuid.NewString()}, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestListCompanies(t *testing.T) {
+	ts := newTestServer(t)
+	for _, company := range []models.Company{
+		{Name: "Acme", Employees: 30, Registered: true, Type: models.Corporation},
+		{Name: "Globex", Employees: 10, Type: models.Corporation},
+		{Name: "Initech", Employees: 20, Registered: true, Type: models.Cooperative},
+		{Name: "Umbrella", Employees: 40, Registered: true, Type: models.Corporation},
+	} {
+		ts.createCompany(company)
+	}
+
+	names := func(list models.CompanyList) []string {
+		var names []string
+		for _, company := range list.Companies {
+			names = append(names, company.Name)
+		}
+		return names
+	}
+
+	var list models.CompanyList
+	ts.expect(request{method: "GET", path: "/companies?type=Corporation&registered=true&sort=-employees", role: models.RoleViewer}, http.StatusOK, &list)
+	if got := names(list); len(got) != 2 || got[0] != "Umbrella" || got[1] != "Acme" {
+		t.Errorf("filter: got %v, want [Umbrella Acme]", got)
+	}
+
+	// walk the pages sorted on employees
+	var walked []string
+	path := "/companies?sort=employees&limit=3"
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("pagination: the pages don't end")
+		}
+		list = models.CompanyList{}
+		ts.expect(request{method: "GET", path: path, role: models.RoleViewer}, http.StatusOK, &list)
+		walked = append(walked, names(list)...)
+		if list.Next == "" {
+			break
+		}
+		path = "/companies?sort=employees&limit=3&next=" + list.Next
+	}
+	want := []string{"Globex", "Initech", "Acme", "Umbrella"}
+	if len(walked) != len(want) {
+		t.Fatalf("pagination: got %v, want %v", walked, want)
+	}
+	for i := range want {
+		if walked[i] != want[i] {
+			t.Fatalf("pagination: got %v, want %v", walked, want)
+		}
+	}
+
+	ts.expectProblem(request{method: "GET", path: "/companies?sort=created", role: models.RoleViewer}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "GET", path: "/companies?next=bm90LWEtY3Vyc29y", role: models.RoleViewer}, http.StatusBadRequest, "validation")
+}
+
+func TestPatchCompany(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Description: "Anvils", Employees: 12, Type: models.Corporation})
+	path := "/companies/" + id.String()
+
+	var company models.Company
+	res := ts.expect(request{method: "PATCH", path: path, role: models.RoleEditor, body: `{"employees": 15, "description": null}`,
+		headers: map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"1"`}}, http.StatusOK, &company)
+	if company.Employees != 15 || company.Description != "" || company.Name != "Acme" {
+		t.Errorf("merge patch: got %+v", company)
+	}
+	if etag := res.Header.Get("ETag"); etag != `"2"` {
+		t.Errorf("merge patch: got ETag %q, want \"2\"", etag)
+	}
+
+	ts.expect(request{method: "PATCH", path: path, role: models.RoleEditor, body: `[{"op": "replace", "path": "/registered", "value": true}]`,
+		headers: map[string]string{"Content-Type": "application/json-patch+json"}}, http.StatusOK, &company)
+	if !company.Registered || company.Employees != 15 {
+		t.Errorf("json patch: got %+v", company)
+	}
+
+	ts.expectProblem(request{method: "PATCH", path: path, role: models.RoleEditor, body: `{"employees": 20}`,
+		headers: map[string]string{"If-Match": `"1"`}}, http.StatusPreconditionFailed, "precondition-failed")
+	ts.expectProblem(request{method: "PATCH", path: path, role: models.RoleEditor, body: `{"type": "Guild"}`}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "PATCH", path: path, role: models.RoleEditor, body: `{"founded": 1999}`}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "PATCH", path: path, role: models.RoleEditor, body: `employees=20`,
+		headers: map[string]string{"Content-Type": "text/plain"}}, http.StatusUnsupportedMediaType, "validation")
+	ts.expectProblem(request{method: "PATCH", path: "/companies/" + uuid.NewString(), role: models.RoleEditor, body: `{}`}, http.StatusNotFound, "not-found")
+}
+
+func TestPutCompany(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Description: "Anvils", Employees: 12, Type: models.Corporation})
+	ts.createCompany(models.Company{Name: "Globex", Type: models.Corporation})
+	path := "/companies/" + id.String()
+
+	var company models.Company
+	ts.expect(request{method: "PUT", path: path, role: models.RoleEditor, body: models.Company{Name: "Acme", Type: models.Cooperative},
+		headers: map[string]string{"If-Match": `"1"`}}, http.StatusOK, &company)
+	if company.Description != "" || company.Employees != 0 || company.Type != models.Cooperative {
+		t.Errorf("put: got %+v, want the fields left out reset", company)
+	}
+
+	ts.expectProblem(request{method: "PUT", path: path, role: models.RoleEditor, body: models.Company{Name: "Acme", Type: models.Corporation},
+		headers: map[string]string{"If-Match": `"1"`}}, http.StatusPreconditionFailed, "precondition-failed")
+	ts.expectProblem(request{method: "PUT", path: path, role: models.RoleEditor,
+		body: models.Company{Name: "Globex", Type: models.Corporation}}, http.StatusConflict, "conflict")
+	ts.expectProblem(request{method: "PUT", path: path, role: models.RoleEditor,
+		body: models.Company{ID: uuid.New(), Name: "Acme", Type: models.Corporation}}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "PUT", path: "/companies/" + uuid.NewString(), role: models.RoleEditor,
+		body: models.Company{Name: "Initech", Type: models.Corporation}}, http.StatusNotFound, "not-found")
+}
+
+func TestDeleteAndRestoreCompany(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+	path := "/companies/" + id.String()
+
+	ts.expectProblem(request{method: "POST", path: path + "/restore", role: models.RoleAdmin}, http.StatusConflict, "conflict")
+	ts.expectProblem(request{method: "DELETE", path: path, role: models.RoleAdmin,
+		headers: map[string]string{"If-Match": `"7"`}}, http.StatusPreconditionFailed, "precondition-failed")
+
+	ts.expect(request{method: "DELETE", path: path, role: models.RoleAdmin, headers: map[string]string{"If-Match": `"1"`}}, http.StatusOK, nil)
+	ts.expectProblem(request{method: "GET", path: path, role: models.RoleViewer}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "DELETE", path: path, role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+
+	var list models.CompanyList
+	ts.expect(request{method: "GET", path: "/companies", role: models.RoleViewer}, http.StatusOK, &list)
+	if len(list.Companies) != 0 {
+		t.Errorf("list: got %+v, want the deleted company left out", list.Companies)
+	}
+	ts.expect(request{method: "GET", path: "/companies?include_deleted=true", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Companies) != 1 || list.Companies[0].DeletedAt == nil {
+		t.Errorf("include_deleted: got %+v, want the deleted company", list.Companies)
+	}
+
+	var company models.Company
+	ts.expect(request{method: "POST", path: path + "/restore", role: models.RoleAdmin}, http.StatusOK, &company)
+	if company.ID != id || company.DeletedAt != nil {
+		t.Errorf("restore: got %+v", company)
+	}
+	ts.expect(request{method: "GET", path: path, role: models.RoleViewer}, http.StatusOK, nil)
+	ts.expectProblem(request{method: "POST", path: "/companies/" + uuid.NewString() + "/restore", role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+}
+
+func TestRoleDenials(t *testing.T) {
+	ts := newTestServer(t)
+	id := ts.createCompany(models.Company{Name: "Acme", Type: models.Corporation})
+	path := "/companies/" + id.String()
+
+	for _, req := range []request{
+		{method: "POST", path: "/companies", role: models.RoleViewer, body: models.Company{Name: "Globex", Type: models.Corporation}},
+		{method: "PATCH", path: path, role: models.RoleViewer, body: `{"employees": 1}`},
+		{method: "PUT", path: path, role: models.RoleViewer, body: models.Company{Name: "Acme", Type: models.Corporation}},
+		{method: "DELETE", path: path, role: models.RoleEditor},
+		{method: "POST", path: path + "/restore", role: models.RoleEditor},
+		{method: "GET", path: "/companies?include_deleted=true", role: models.RoleEditor},
+		{method: "GET", path: path + "/history", role: models.RoleEditor},
+		{method: "GET", path: "/webhooks", role: models.RoleEditor},
+	} {
+		res, body := ts.do(req)
+		var p problem
+		_ = json.Unmarshal(body, &p)
+		if res.StatusCode != http.StatusForbidden || p.Reason != "insufficient_role" {
+			t.Errorf("%s %s as %s: got status %d, want 403 for an insufficient role: %s", req.method, req.path, req.role, res.StatusCode, body)
+		}
+		if res.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: no WWW-Authenticate challenge", req.method, req.path)
+		}
+	}
+
+	// the denied requests changed nothing
+	var company models.Company
+	ts.expect(request{method: "GET", path: path, role: models.RoleViewer}, http.StatusOK, &company)
+	if company.Employees != 0 || company.DeletedAt != nil {
+		t.Errorf("got %+v, want the company unchanged", company)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/auth"
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/transfer"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxJobInput bounds the file of an import job, unless the handler is given another bound
+const DefaultMaxJobInput = 64 << 20
+
+// @Summary Queue a background job
+// @Description Queue a job run by the background workers. The import job takes the file and the parameters of POST /companies/import. The job is resumed from its last checkpoint when the service restarts.
+// @Tags jobs
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param type query string true "import"
+// @Param format query string false "csv or ndjson, the Content-Type when missing"
+// @Param dry_run query bool false "Validate and try the rows without applying them"
+// @Param upsert query bool false "Replace the companies with the same name"
+// @Success 202 {object} models.Job
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 413
+// @Router /jobs [post]
+func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	switch t := models.JobType(r.URL.Query().Get("type")); t {
+	case models.JobImport:
+		params, _, err := parseImportParams(r)
+		if err != nil {
+			apperror.Write(w, r, err)
+			return
+		}
+		h.enqueueImport(w, r, params)
+	default:
+		apperror.Write(w, r, apperror.New(apperror.Validation, "type must be %s", models.JobImport))
+	}
+}
+
+// enqueueImport queues the file of the request as an import job
+func (h *Handler) enqueueImport(w http.ResponseWriter, r *http.Request, params models.ImportParams) {
+	limit := h.MaxJobInput
+	if limit <= 0 {
+		limit = DefaultMaxJobInput
+	}
+	// the byte past the limit tells a file too large
+	input, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		apperror.Write(w, r, apperror.Wrap(apperror.Validation, err, "Unable to read the file"))
+		return
+	}
+	if int64(len(input)) > limit {
+		apperror.Write(w, r, apperror.WithStatus(apperror.Validation, http.StatusRequestEntityTooLarge, "The file is larger than %d bytes", limit))
+		return
+	}
+	// a file the job can't read at all is refused right away
+	if _, err := transfer.NewReader(transfer.Format(params.Format), bytes.NewReader(input)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	a := actor(r)
+	job, err := h.Store.CreateJobQuery(models.Job{
+		Type:      models.JobImport,
+		Params:    params,
+		Report:    models.ImportReport{DryRun: params.DryRun, Errors: []models.ImportError{}},
+		CreatedBy: a.Subject,
+		RequestID: a.RequestID,
+	}, input)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID.String())
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// @Summary Get a job by ID
+// @Description Get the status of a job with the report of its progress: the rows read, created, updated and failed and the errors of the rows. Only admins see the jobs of the other users.
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /jobs/{id} [get]
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "job")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	job, err := h.ownJob(r, id)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// @Summary Cancel a job by ID
+// @Description Cancel a queued or running job. A running import stops before its next chunk, the chunks applied before stay. Only admins cancel the jobs of the other users.
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Router /jobs/{id} [delete]
+func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "job")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if _, err := h.ownJob(r, id); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	job, err := h.Store.CancelJobQuery(id)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// ownJob returns a job created by the user of the request, the jobs of the other users
+// are not found unless the user is allowed to manage them
+func (h *Handler) ownJob(r *http.Request, id uuid.UUID) (models.Job, error) {
+	job, err := h.Store.GetJobQuery(id)
+	if err != nil {
+		return job, err
+	}
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return models.Job{}, auth.ErrAuthenticationRequired
+	}
+	if job.CreatedBy != claims.Subject && !auth.Allowed(claims.Role, auth.ManageJobs) {
+		return models.Job{}, database.ErrJobNotFound
+	}
+	return job, nil
+}
@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+func TestJobsOfOtherUsers(t *testing.T) {
+	ts := newTestServer(t)
+	other := ts.createUser("other-editor@example.com", models.RoleEditor)
+
+	var job models.Job
+	res := ts.expect(request{method: "POST", path: "/jobs?type=import", role: models.RoleEditor, body: "name,type\nAcme,Corporation\n",
+		headers: map[string]string{"Content-Type": "text/csv"}}, http.StatusAccepted, &job)
+	path := "/jobs/" + job.ID.String()
+	if location := res.Header.Get("Location"); location != path {
+		t.Errorf("got Location %q, want %q", location, path)
+	}
+
+	ts.expectProblem(request{method: "GET", path: path, token: other}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "DELETE", path: path, token: other}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "GET", path: path, role: models.RoleViewer}, http.StatusForbidden, "forbidden")
+
+	ts.expect(request{method: "GET", path: path, role: models.RoleEditor}, http.StatusOK, &job)
+	if job.Status != models.JobQueued {
+		t.Errorf("got status %s, want the job still queued", job.Status)
+	}
+	ts.expect(request{method: "GET", path: path, role: models.RoleAdmin}, http.StatusOK, nil)
+
+	ts.expect(request{method: "DELETE", path: path, role: models.RoleAdmin}, http.StatusOK, &job)
+	if job.Status != models.JobCancelled {
+		t.Errorf("got status %s, want the job cancelled", job.Status)
+	}
+	ts.expectProblem(request{method: "DELETE", path: path, role: models.RoleEditor}, http.StatusConflict, "conflict")
+}
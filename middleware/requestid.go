@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/auth"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the id of a request, it is taken from the client when given
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the ids accepted from the clients
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives every request an id, sent back in the X-Request-ID header and recorded in the audit log
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts the ids of printable ASCII characters only, they end up in the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the id given to a request by RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// actor identifies the authenticated user of a request and the request, for the audit log
+func actor(r *http.Request) models.Actor {
+	a := models.Actor{RequestID: RequestIDFromContext(r.Context())}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		a.Subject = claims.Subject
+	}
+	return a
+}
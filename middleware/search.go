@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// MaxSearchLength bounds the length of a search query, in characters
+const MaxSearchLength = 200
+
+// @Summary Search companies
+// @Description Search the companies by the words of their name and description, a word of the query matching the start of a word, and by names close to the query to allow for typos. The best matches come first, with the words matched wrapped in <mark> tags and the text HTML escaped.
+// @Tags company
+// @Produce json
+// @Param q query string true "Words to search for"
+// @Param limit query int false "Number of results"
+// @Success 200 {object} models.SearchResponse
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /companies/search [get]
+func (h *Handler) SearchCompanies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > MaxSearchLength {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "q must have 1 to %d characters", MaxSearchLength))
+		return
+	}
+	limit := database.DefaultListLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > database.MaxListLimit {
+			apperror.Write(w, r, apperror.New(apperror.Validation, "invalid limit %q, expected 1 to %d", v, database.MaxListLimit))
+			return
+		}
+	}
+
+	results, err := h.Store.SearchCompaniesQuery(q, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(models.SearchResponse{Query: q, Results: results})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/auth"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// @Summary Refresh a token
+// @Description Exchange a refresh token for a new access token and a new refresh token, every refresh token can be used once
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.Token
+// @Failure 400
+// @Failure 401
+// @Router /token/refresh [post]
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
+		return
+	}
+
+	token, err := h.Auth.Refresh(req.RefreshToken)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(token)
+}
+
+// @Summary Log out
+// @Description Revoke the token of the request and the refresh tokens of its login
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200
+// @Failure 401
+// @Router /logout [post]
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	if err := h.Auth.Logout(claims); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	writeResponse(w, http.StatusOK, "Logged out")
+}
+
+// @Summary Revoke a token
+// @Description Revoke the access token with the given jti and the refresh tokens issued with it
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param revoke body models.RevokeRequest true "jti of the token"
+// @Security BearerAuth
+// @Success 200
+// @Failure 400
+// @Failure 401
+// @Failure 403
+// @Router /tokens/revoke [post]
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RevokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.JTI == "" {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "jti is required"))
+		return
+	}
+
+	if err := h.Auth.Revoke(req.JTI); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	writeResponse(w, http.StatusOK, "Token revoked")
+}
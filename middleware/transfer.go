@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/auth"
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/transfer"
+)
+
+// exportFlushRows is the number of companies an export sends at once
+const exportFlushRows = 100
+
+// @Summary Export the companies
+// @Description Stream every company matching the filters, as CSV or NDJSON, sorted like the list. The export is not cut by the write timeout of the server while the client keeps reading.
+// @Tags company
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "csv (default) or ndjson"
+// @Param type query string false "Company type"
+// @Param registered query bool false "Registered or not"
+// @Param min_employees query int false "Minimum number of employees"
+// @Param max_employees query int false "Maximum number of employees"
+// @Param name_prefix query string false "Start of the name, case sensitive"
+// @Param include_deleted query bool false "Include the deleted companies waiting to be purged"
+// @Param sort query string false "id, name, description, employees, registered or type, prefixed with - for descending"
+// @Success 200
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /companies/export [get]
+func (h *Handler) ExportCompanies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := transfer.CSV
+	if v := query.Get("format"); v != "" {
+		var err error
+		if format, err = transfer.ParseFormat(v); err != nil {
+			apperror.Write(w, r, err)
+			return
+		}
+	}
+	filter, err := parseCompanyFilter(query)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	// an export isn't paginated
+	filter.Limit, filter.Cursor = 0, ""
+	if filter.IncludeDeleted {
+		if err := auth.Check(w, r, auth.ReadDeletedCompanies); err != nil {
+			apperror.Write(w, r, err)
+			return
+		}
+	}
+
+	// the headers are sent with the first company, an error before it is still reported as a problem
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="companies.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+	}
+	writer := transfer.NewWriter(format, w)
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+
+	err = h.Store.ExportCompaniesQuery(filter, func(company models.Company) error {
+		if !started {
+			start()
+		}
+		if err := writer.Write(company); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			// the write timeout of the server would cut a long export
+			h.extendWriteDeadline(r)
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		if !started {
+			start()
+		}
+		h.extendWriteDeadline(r)
+		err = writer.Flush()
+	}
+	if err != nil {
+		if !started {
+			apperror.Write(w, r, err)
+			return
+		}
+		// the status is sent, aborting the response tells the client the file is cut short
+		logger.Errorf("The export stopped after %d companies. %v", rows, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// @Summary Import companies
+// @Description Create the companies of a CSV or NDJSON file, the format is the format parameter or the Content-Type. The rows that fail are left out and listed in the report by their line. With upsert the company with the same name is replaced instead of failing as a conflict; a dry run reports what the import would do without applying it. With async the file is queued as a job and the response is the job, to follow with GET /jobs/{id}.
+// @Tags company
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "csv or ndjson, the Content-Type when missing"
+// @Param dry_run query bool false "Validate and try the rows without applying them"
+// @Param upsert query bool false "Replace the companies with the same name"
+// @Param async query bool false "Run the import as a background job"
+// @Success 200 {object} models.ImportReport
+// @Success 202 {object} models.Job
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /companies/import [post]
+func (h *Handler) ImportCompanies(w http.ResponseWriter, r *http.Request) {
+	params, async, err := parseImportParams(r)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if async {
+		h.enqueueImport(w, r, params)
+		return
+	}
+
+	reader, err := transfer.NewReader(transfer.Format(params.Format), r.Body)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	options := transfer.Options{DryRun: params.DryRun, Upsert: params.Upsert}
+	report, err := transfer.Import(r.Context(), h.Store, actor(r), reader, options)
+	if err != nil {
+		// the rows before the error are applied, the report tells which
+		detail := apperror.ProblemOf(err).Detail
+		apperror.Write(w, r, apperror.Wrap(apperror.KindOf(err), err, "The import stopped after %d rows: %s", report.Rows, detail).With("report", report))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// parseImportParams reads the options of an import, the format is the Content-Type when the parameter is missing
+func parseImportParams(r *http.Request) (models.ImportParams, bool, error) {
+	query := r.URL.Query()
+	var params models.ImportParams
+	if v := query.Get("format"); v != "" {
+		format, err := transfer.ParseFormat(v)
+		if err != nil {
+			return params, false, err
+		}
+		params.Format = string(format)
+	} else {
+		format, ok := transfer.FormatOf(r.Header.Get("Content-Type"))
+		if !ok {
+			return params, false, apperror.New(apperror.Validation, "Unknown format, set the format parameter or a Content-Type of text/csv or application/x-ndjson")
+		}
+		params.Format = string(format)
+	}
+
+	var async bool
+	for name, value := range map[string]*bool{"dry_run": &params.DryRun, "upsert": &params.Upsert, "async": &async} {
+		if v := query.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return params, false, apperror.New(apperror.Validation, "invalid %s %q", name, v)
+			}
+			*value = b
+		}
+	}
+	return params, async, nil
+}
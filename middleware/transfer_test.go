@@ -0,0 +1,52 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	handlers "github.com/jain-chetan/companyservice/middleware"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// slowExportStore exports the companies slowly, like a large table would
+type slowExportStore struct {
+	database.Store
+	delay time.Duration
+}
+
+func (s slowExportStore) ExportCompaniesQuery(filter models.CompanyFilter, fn func(company models.Company) error) error {
+	return s.Store.ExportCompaniesQuery(filter, func(company models.Company) error {
+		time.Sleep(s.delay)
+		return fn(company)
+	})
+}
+
+func TestExportOutlivesTheWriteTimeout(t *testing.T) {
+	const writeTimeout = 100 * time.Millisecond
+	ts := startTestServer(t, func(h *handlers.Handler, s *http.Server) {
+		// 300 companies take 3 times the write timeout, 100 of them take a third of it
+		h.Store = slowExportStore{Store: h.Store, delay: writeTimeout / 300}
+		h.WriteTimeout = writeTimeout
+		s.WriteTimeout = writeTimeout
+		s.ConnContext = handlers.ConnContext
+	})
+	for i := 0; i < 300; i++ {
+		// straight to the store, the names are too close for the duplicate check
+		if _, err := ts.store.CreateCompanyQuery(models.Actor{}, models.Company{Name: fmt.Sprintf("Company %03d", i), Type: models.Corporation}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	res, body := ts.do(request{method: "GET", path: "/companies/export?format=csv&sort=name", role: models.RoleViewer})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", res.StatusCode, body)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 301 || !strings.Contains(lines[300], "Company 299") {
+		t.Errorf("got %d lines ending with %q, want the header and the 300 companies", len(lines), lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	"github.com/jain-chetan/companyservice/auth"
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// writeResponse sends a models.Response with the given status, the errors are sent with apperror.Write
+func writeResponse(w http.ResponseWriter, code int, message string) {
+	res := models.Response{
+		Code:    code,
+		Message: message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// @Summary Register a user
+// @Description Create a user account with an email and a password of at least 8 characters, with the viewer role unless the email is one of the configured admin emails
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body models.User true "Email and password of the user"
+// @Success 201 {object} models.User
+// @Failure 400
+// @Failure 409
+// @Router /users [post]
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+
+	err := json.NewDecoder(r.Body).Decode(&user)
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
+		return
+	}
+
+	user.Email = strings.TrimSpace(user.Email)
+	if address, err := mail.ParseAddress(user.Email); err != nil || address.Address != user.Email {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "A valid email is required"))
+		return
+	}
+
+	// the role is never taken from the request, admins change it afterwards
+	user.Role = models.RoleViewer
+	if h.AdminEmails[strings.ToLower(user.Email)] {
+		user.Role = models.RoleAdmin
+	}
+
+	user.PasswordHash, err = auth.HashPassword(user.Password)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	user, err = h.Store.CreateUserQuery(user)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// @Summary Log in
+// @Description Verify the email and password of a user and return a token
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body models.User true "Email and password of the user"
+// @Success 200 {object} models.Token
+// @Failure 400
+// @Failure 401
+// @Router /login [post]
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var credentials models.User
+
+	err := json.NewDecoder(r.Body).Decode(&credentials)
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
+		return
+	}
+
+	user, err := h.Store.GetUserByEmailQuery(strings.TrimSpace(credentials.Email))
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	// an unknown user has an empty hash, it is checked all the same to take as long as a known one
+	if err := auth.CheckPassword(user.PasswordHash, credentials.Password); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	token, err := h.Auth.CreateToken(user)
+	if err != nil {
+		apperror.Write(w, r, apperror.Wrap(apperror.Internal, err, "Unable to create token"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(token)
+}
+
+// @Summary Change the role of a user
+// @Description Give a user the viewer, editor or admin role, it applies to the tokens issued from then on
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param role body models.RoleRequest true "New role"
+// @Success 200 {object} models.User
+// @Failure 400
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /users/{id}/role [put]
+func (h *Handler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid user id"))
+		return
+	}
+
+	var req models.RoleRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || !auth.ValidRole(req.Role) {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "role must be viewer, editor or admin"))
+		return
+	}
+
+	user, err := h.Store.UpdateUserRoleQuery(id, req.Role)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
+	"github.com/jain-chetan/companyservice/webhook"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// @Summary Subscribe a webhook
+// @Description Subscribe a url to the company events of the types given, every type when none is. The secret signing the payloads is only sent in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.WebhookRequest true "Url and event types"
+// @Success 201 {object} models.Webhook
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /webhooks [post]
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.WebhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apperror.Write(w, r, apperror.New(apperror.Validation, "Invalid request body: %v", err))
+		return
+	}
+	if err := validation.WebhookError(validation.Webhook(req)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		apperror.Write(w, r, apperror.Wrap(apperror.Internal, err, "Unable to generate the secret"))
+		return
+	}
+	created, err := h.Store.CreateWebhookQuery(models.Webhook{
+		URL:        req.URL,
+		EventTypes: uniqueEventTypes(req.EventTypes),
+		Secret:     secret,
+		CreatedBy:  actor(r).Subject,
+	})
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/webhooks/"+created.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
+
+// uniqueEventTypes drops the repeated event types, keeping their order
+func uniqueEventTypes(types []models.EventType) []models.EventType {
+	seen := make(map[models.EventType]bool, len(types))
+	unique := []models.EventType{}
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// @Summary List the webhooks
+// @Description List the webhooks, without their secrets
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} models.WebhookList
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Router /webhooks [get]
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.Store.ListWebhooksQuery()
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(models.WebhookList{Webhooks: webhooks})
+}
+
+// @Summary Get a webhook by ID
+// @Description Get a webhook, without its secret
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /webhooks/{id} [get]
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	found, err := h.Store.GetWebhookQuery(id)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	found.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(found)
+}
+
+// @Summary Delete a webhook by ID
+// @Description Unsubscribe a webhook, its pending deliveries are dropped
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if err := h.Store.DeleteWebhookQuery(id); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	writeResponse(w, http.StatusOK, "Deleted Successfully")
+}
+
+// @Summary Deliveries of a webhook
+// @Description List the deliveries of the events to a webhook, newest first, with every attempt and its status code, error and duration
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "pending, delivered or dead"
+// @Param limit query int false "Number of deliveries"
+// @Success 200 {object} models.DeliveryList
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /webhooks/{id}/deliveries [get]
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	status := models.DeliveryStatus(query.Get("status"))
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		apperror.Write(w, r, apperror.New(apperror.Validation, "invalid status %q", status))
+		return
+	}
+	limit := database.DefaultListLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > database.MaxListLimit {
+			apperror.Write(w, r, apperror.New(apperror.Validation, "invalid limit %q, expected 1 to %d", v, database.MaxListLimit))
+			return
+		}
+	}
+
+	deliveries, err := h.Store.ListDeliveriesQuery(id, status, limit)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(models.DeliveryList{Deliveries: deliveries})
+}
+
+// @Summary Redeliver an event to a webhook
+// @Description Make a delivery pending again right away, a dead one included, its attempts are kept
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 400
+// @Security BearerAuth
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Router /webhooks/{id}/deliveries/{delivery_id}/retry [post]
+func (h *Handler) RedeliverDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	deliveryID, err := pathID(r, "delivery_id", "delivery")
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	delivery, err := h.Store.RedeliverQuery(id, deliveryID)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(delivery)
+}
+
+// pathID parses an id of the request path
+func pathID(r *http.Request, name, what string) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		return id, apperror.New(apperror.Validation, "Invalid %s id", what)
+	}
+	return id, nil
+}
@@ -0,0 +1,179 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// createWebhook subscribes a webhook as an admin and returns it with its secret
+func (ts *testServer) createWebhook(req models.WebhookRequest) models.Webhook {
+	ts.t.Helper()
+	var created models.Webhook
+	res := ts.expect(request{method: "POST", path: "/webhooks", role: models.RoleAdmin, body: req}, http.StatusCreated, &created)
+	if location := res.Header.Get("Location"); location != "/webhooks/"+created.ID.String() {
+		ts.t.Errorf("got Location %q, want the webhook", location)
+	}
+	return created
+}
+
+// deadDelivery enqueues an event for the webhooks and records a last failed attempt of its
+// delivery, it returns the id of the delivery
+func (ts *testServer) deadDelivery() uuid.UUID {
+	ts.t.Helper()
+	event := models.Event{ID: uuid.New(), Type: models.CompanyCreated, CompanyID: uuid.New(), OccurredAt: time.Now()}
+	if _, err := ts.store.EnqueueDeliveriesQuery(event); err != nil {
+		ts.t.Fatalf("enqueue: %v", err)
+	}
+	deliveries, err := ts.store.ClaimDeliveriesQuery(10, time.Minute)
+	if err != nil || len(deliveries) != 1 {
+		ts.t.Fatalf("claim: got %d deliveries, %v, want 1", len(deliveries), err)
+	}
+	attempt := models.DeliveryAttempt{Attempt: 1, StatusCode: http.StatusServiceUnavailable, Error: "unexpected status 503", AttemptedAt: time.Now()}
+	if err := ts.store.RecordDeliveryAttemptQuery(deliveries[0].ID, attempt, models.DeliveryDead, nil); err != nil {
+		ts.t.Fatalf("record the attempt: %v", err)
+	}
+	return deliveries[0].ID
+}
+
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t)
+
+	created := ts.createWebhook(models.WebhookRequest{URL: "https://hooks.example.com/companies",
+		EventTypes: []models.EventType{models.CompanyCreated, models.CompanyDeleted, models.CompanyCreated}})
+	if created.ID == uuid.Nil || created.Secret == "" || created.CreatedBy != ts.subject(ts.tokens[models.RoleAdmin]) {
+		t.Errorf("got the webhook %+v, want an id, a secret and its creator", created)
+	}
+	if len(created.EventTypes) != 2 || created.EventTypes[0] != models.CompanyCreated || created.EventTypes[1] != models.CompanyDeleted {
+		t.Errorf("got the event types %v, want the repeated one dropped", created.EventTypes)
+	}
+	every := ts.createWebhook(models.WebhookRequest{URL: "https://other.example.com/hooks"})
+	if len(every.EventTypes) != 0 {
+		t.Errorf("got the event types %v, want none for every type", every.EventTypes)
+	}
+
+	// the secret is only sent on the creation
+	var found models.Webhook
+	ts.expect(request{method: "GET", path: "/webhooks/" + created.ID.String(), role: models.RoleAdmin}, http.StatusOK, &found)
+	if found.ID != created.ID || found.URL != created.URL || found.Secret != "" {
+		t.Errorf("got %+v, want the webhook without its secret", found)
+	}
+	var list models.WebhookList
+	ts.expect(request{method: "GET", path: "/webhooks", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Webhooks) != 2 {
+		t.Fatalf("got %d webhooks, want 2", len(list.Webhooks))
+	}
+	for _, webhook := range list.Webhooks {
+		if webhook.Secret != "" {
+			t.Errorf("got the secret of %s in the list", webhook.ID)
+		}
+	}
+
+	ts.expect(request{method: "DELETE", path: "/webhooks/" + every.ID.String(), role: models.RoleAdmin}, http.StatusOK, nil)
+	ts.expectProblem(request{method: "GET", path: "/webhooks/" + every.ID.String(), role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "DELETE", path: "/webhooks/" + every.ID.String(), role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "GET", path: "/webhooks/hook", role: models.RoleAdmin}, http.StatusBadRequest, "validation")
+	list = models.WebhookList{}
+	ts.expect(request{method: "GET", path: "/webhooks", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Webhooks) != 1 || list.Webhooks[0].ID != created.ID {
+		t.Errorf("got the webhooks %+v, want the one left", list.Webhooks)
+	}
+
+	// the webhooks are for the admins only
+	for _, req := range []request{
+		{method: "POST", path: "/webhooks", role: models.RoleEditor, body: models.WebhookRequest{URL: "https://hooks.example.com"}},
+		{method: "GET", path: "/webhooks", role: models.RoleEditor},
+		{method: "GET", path: "/webhooks/" + created.ID.String(), role: models.RoleViewer},
+		{method: "DELETE", path: "/webhooks/" + created.ID.String(), role: models.RoleEditor},
+	} {
+		ts.expectProblem(req, http.StatusForbidden, "forbidden")
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		body  interface{}
+		field string
+		code  string
+	}{
+		{models.WebhookRequest{}, "url", "required"},
+		{models.WebhookRequest{URL: "ftp://hooks.example.com"}, "url", "invalid_url"},
+		{models.WebhookRequest{URL: "http://localhost:8080/hooks"}, "url", "forbidden_address"},
+		{models.WebhookRequest{URL: "http://10.1.2.3/hooks"}, "url", "forbidden_address"},
+		{models.WebhookRequest{URL: "http://169.254.169.254/latest/meta-data/"}, "url", "forbidden_address"},
+		{models.WebhookRequest{URL: "http://[::1]/hooks"}, "url", "forbidden_address"},
+		{models.WebhookRequest{URL: "https://hooks.example.com", EventTypes: []models.EventType{"CompanyRenamed"}}, "event_types", "not_allowed"},
+	}
+	for _, test := range tests {
+		p := ts.expectProblem(request{method: "POST", path: "/webhooks", role: models.RoleAdmin, body: test.body}, http.StatusBadRequest, "validation")
+		if len(p.Errors) != 1 || p.Errors[0].Field != test.field || p.Errors[0].Code != test.code {
+			t.Errorf("%+v: got the errors %+v, want %s %s", test.body, p.Errors, test.field, test.code)
+		}
+	}
+
+	ts.expectProblem(request{method: "POST", path: "/webhooks", role: models.RoleAdmin,
+		body: `{"url": "https://hooks.example.com", "secret": "mine"}`}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "POST", path: "/webhooks", role: models.RoleAdmin, body: `{"url":`}, http.StatusBadRequest, "validation")
+
+	var list models.WebhookList
+	ts.expect(request{method: "GET", path: "/webhooks", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Webhooks) != 0 {
+		t.Errorf("got the webhooks %+v, want none created", list.Webhooks)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	ts := newTestServer(t)
+	webhook := ts.createWebhook(models.WebhookRequest{URL: "https://hooks.example.com/companies"})
+	id := ts.deadDelivery()
+	deliveries := "/webhooks/" + webhook.ID.String() + "/deliveries"
+
+	var list models.DeliveryList
+	ts.expect(request{method: "GET", path: deliveries + "?status=dead", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Deliveries) != 1 || list.Deliveries[0].ID != id {
+		t.Fatalf("got the dead deliveries %+v, want the one failed", list.Deliveries)
+	}
+
+	// the delivery is pending again right away, its attempts are kept and its count starts over
+	// with the backoff
+	var delivery models.WebhookDelivery
+	ts.expect(request{method: "POST", path: deliveries + "/" + id.String() + "/retry", role: models.RoleAdmin}, http.StatusOK, &delivery)
+	if delivery.ID != id || delivery.Status != models.DeliveryPending || delivery.AttemptCount != 0 {
+		t.Errorf("got %s with an attempt count of %d, want pending from 0", delivery.Status, delivery.AttemptCount)
+	}
+	if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(time.Now()) {
+		t.Errorf("got the next attempt at %v, want it due", delivery.NextAttemptAt)
+	}
+	list = models.DeliveryList{}
+	ts.expect(request{method: "GET", path: deliveries + "?status=dead", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Deliveries) != 0 {
+		t.Errorf("got the dead deliveries %+v, want none", list.Deliveries)
+	}
+	list = models.DeliveryList{}
+	ts.expect(request{method: "GET", path: deliveries + "?status=pending", role: models.RoleAdmin}, http.StatusOK, &list)
+	if len(list.Deliveries) != 1 || len(list.Deliveries[0].Attempts) != 1 || list.Deliveries[0].Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got the pending deliveries %+v, want the one retried with its attempt", list.Deliveries)
+	}
+
+	// a delivery is only found under its webhook
+	other := ts.createWebhook(models.WebhookRequest{URL: "https://other.example.com/hooks"})
+	ts.expectProblem(request{method: "POST", path: "/webhooks/" + other.ID.String() + "/deliveries/" + id.String() + "/retry", role: models.RoleAdmin},
+		http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "POST", path: deliveries + "/" + uuid.NewString() + "/retry", role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+	ts.expectProblem(request{method: "POST", path: deliveries + "/delivery/retry", role: models.RoleAdmin}, http.StatusBadRequest, "validation")
+	ts.expectProblem(request{method: "POST", path: deliveries + "/" + id.String() + "/retry", role: models.RoleEditor}, http.StatusForbidden, "forbidden")
+	ts.expectProblem(request{method: "GET", path: deliveries + "?status=lost", role: models.RoleAdmin}, http.StatusBadRequest, "validation")
+
+	// unsubscribing drops the pending deliveries
+	ts.expect(request{method: "DELETE", path: "/webhooks/" + webhook.ID.String(), role: models.RoleAdmin}, http.StatusOK, nil)
+	ts.expectProblem(request{method: "POST", path: deliveries + "/" + id.String() + "/retry", role: models.RoleAdmin}, http.StatusNotFound, "not-found")
+	if pending, err := ts.store.ClaimDeliveriesQuery(10, time.Minute); err != nil || len(pending) != 0 {
+		t.Errorf("claim: got %d deliveries, %v, want none left", len(pending), err)
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actor identifies who makes a change and the request it is made in
+type Actor struct {
+	Subject   string
+	RequestID string
+}
+
+// AuditAction is the kind of change an audit entry records
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+)
+
+// AuditEntry - one change of a company, with the company before and after it
+type AuditEntry struct {
+	ID        int64       `json:"id"`
+	CompanyID uuid.UUID   `json:"company_id"`
+	Action    AuditAction `json:"action"`
+	Subject   string      `json:"subject"`
+	RequestID string      `json:"request_id,omitempty"`
+	Before    *Company    `json:"before,omitempty"`
+	After     *Company    `json:"after,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// AuditFilter has the filters and cursor used to list the audit entries, newest first
+type AuditFilter struct {
+	CompanyID *uuid.UUID
+	Subject   string
+	Action    AuditAction
+	Since     *time.Time
+	Until     *time.Time
+	Limit     int
+	Cursor    string
+}
+
+// AuditList - response structure for the audit entries where the token of the next page is sent
+type AuditList struct {
+	Entries []AuditEntry `json:"entries"`
+	Next    string       `json:"next,omitempty"`
+}
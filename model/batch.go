@@ -0,0 +1,57 @@
+package models
+
+import (
+	"github.com/jain-chetan/companyservice/apperror"
+
+	"github.com/google/uuid"
+)
+
+// BatchOp is the kind of an operation of a batch
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+	// BatchUpsert replaces the company with the same name, or creates it when there is none
+	BatchUpsert BatchOp = "upsert"
+)
+
+// BatchMode decides what a failed operation does to the rest of a batch
+type BatchMode string
+
+const (
+	// BatchAtomic applies every operation or none
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies the operations that succeed and skips the others
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// CompanyOperation - one operation of a batch. A create or an upsert needs the company,
+// an update the id and the company, which replaces every field like PUT, a delete the id.
+// The version, when given, is the version the company must still have, like If-Match.
+type CompanyOperation struct {
+	Op      BatchOp   `json:"op"`
+	ID      uuid.UUID `json:"id,omitempty"`
+	Version int64     `json:"version,omitempty"`
+	Company *Company  `json:"company,omitempty"`
+}
+
+// BatchResult - the outcome of one operation of a batch, with the id and new version of
+// the company it changed or the problem it failed with
+type BatchResult struct {
+	Index   int               `json:"index"`
+	Op      BatchOp           `json:"op"`
+	Status  int               `json:"status"`
+	ID      *uuid.UUID        `json:"id,omitempty"`
+	Version int64             `json:"version,omitempty"`
+	Error   *apperror.Problem `json:"error,omitempty"`
+}
+
+// BatchResponse - response structure for a batch with the result of every operation, in order
+type BatchResponse struct {
+	Mode      BatchMode     `json:"mode"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
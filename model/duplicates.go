@@ -0,0 +1,11 @@
+package models
+
+import "github.com/google/uuid"
+
+// SimilarCompany - a company whose name is likely the same as the one of a company created,
+// distance is the number of characters that differ once both names are normalized
+type SimilarCompany struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Distance int       `json:"distance"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType is the kind of change an event tells about
+type EventType string
+
+const (
+	CompanyCreated  EventType = "CompanyCreated"
+	CompanyUpdated  EventType = "CompanyUpdated"
+	CompanyDeleted  EventType = "CompanyDeleted"
+	CompanyRestored EventType = "CompanyRestored"
+)
+
+// EventTypes are every type of event published
+var EventTypes = []EventType{CompanyCreated, CompanyUpdated, CompanyDeleted, CompanyRestored}
+
+// Event - a change of a company published to the other services, the company is
+// its state after the change, or before it for a deletion
+type Event struct {
+	ID         uuid.UUID `json:"id"`
+	Type       EventType `json:"type"`
+	CompanyID  uuid.UUID `json:"company_id"`
+	Company    *Company  `json:"company"`
+	Subject    string    `json:"subject,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// PendingEvent - an event of the outbox claimed by the relay, with the attempts made to publish it
+type PendingEvent struct {
+	Event
+	Attempts int
+}
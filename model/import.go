@@ -0,0 +1,22 @@
+package models
+
+import "github.com/jain-chetan/companyservice/apperror"
+
+// ImportReport - summary of an import of companies, with the errors of the rows left out
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+	// ErrorsTruncated is set when more rows failed than are listed
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+// ImportError - the problem of a row of an import, by its line in the file
+type ImportError struct {
+	Line  int               `json:"line"`
+	Name  string            `json:"name,omitempty"`
+	Error *apperror.Problem `json:"error"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+
+	"github.com/google/uuid"
+)
+
+// JobType is the work a background job does
+type JobType string
+
+const (
+	JobImport JobType = "import"
+)
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Finished reports whether a job in the status is done and won't run again
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Job - a long running task run by the workers in the background. The report
+// is saved as the job progresses, the error tells why a failed job stopped.
+type Job struct {
+	ID     uuid.UUID    `json:"id"`
+	Type   JobType      `json:"type"`
+	Status JobStatus    `json:"status"`
+	Params ImportParams `json:"params"`
+	Report ImportReport `json:"report"`
+	// Attempts counts the workers that took the job, a worker stopping gracefully gives its attempt back
+	Attempts  int               `json:"attempts"`
+	Error     *apperror.Problem `json:"error,omitempty"`
+	CreatedBy string            `json:"created_by"`
+	// RequestID is the request that created the job, the changes of the job are audited under it
+	RequestID  string     `json:"request_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ImportParams - the options of an import job
+type ImportParams struct {
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	Upsert bool   `json:"upsert"`
+}
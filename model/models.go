@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Company struct {
 	ID          uuid.UUID   `json:"id,omitempty"`
@@ -9,6 +13,10 @@ type Company struct {
 	Employees   int         `json:"employees"`
 	Registered  bool        `json:"registered"`
 	Type        CompanyType `json:"type"`
+	// Version is incremented on every update, it is sent as the ETag
+	Version int64 `json:"-"`
+	// DeletedAt is set while a deleted company waits to be purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CompanyType string
@@ -20,13 +28,45 @@ const (
 	SoleProprietorship CompanyType = "Sole Proprietorship"
 )
 
+// FieldError - one violation of the validation rules, the code is stable for clients to match on
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CompanyFilter has the filters, sort order and cursor used to list companies
+type CompanyFilter struct {
+	Type         CompanyType
+	Registered   *bool
+	MinEmployees *int
+	MaxEmployees *int
+	NamePrefix   string
+	Sort         string
+	Descending   bool
+	Limit        int
+	Cursor       string
+	// IncludeDeleted lists the deleted companies along with the others
+	IncludeDeleted bool
+}
+
+// CompanyList - response structure for list where the token of the next page is sent
+type CompanyList struct {
+	Companies []Company `json:"companies"`
+	Next      string    `json:"next,omitempty"`
+}
+
 //DBConfig has information required to connect to DB
 type DBConfig struct {
-	Host     string
-	User     string
-	Password string
-	DBName   string
-	Port     string
+	Host            string
+	User            string
+	Password        string
+	DBName          string
+	Port            string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
 //Response has the message and code
@@ -40,9 +80,60 @@ type CreateResponse struct {
 	ID      uuid.UUID `json:"id"`
 	Code    int       `json:"code"`
 	Message string    `json:"message"`
+	// Similar lists the likely duplicates of a company created with allow_similar
+	Similar []SimilarCompany `json:"similar,omitempty"`
+}
+
+// Role grants a set of permissions to the users that have it
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// RoleRequest - request structure for the change of the role of a user
+type RoleRequest struct {
+	Role Role `json:"role"`
+}
+
+// Token - response structure for login where the signed token is sent
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// RefreshToken is a single use token exchanged for a new access token, only its hash is kept
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	AccessJTI string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// RefreshRequest - request structure for refresh where the refresh token is sent
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RevokeRequest - request structure for the admin revocation of a token by its jti
+type RevokeRequest struct {
+	JTI string `json:"jti"`
 }
 
+// User is an account allowed to use the service, the password is only read from requests
 type User struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID           uuid.UUID `json:"id,omitempty"`
+	Email        string    `json:"email"`
+	Password     string    `json:"password,omitempty"`
+	PasswordHash string    `json:"-"`
+	Role         Role      `json:"role,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
 }
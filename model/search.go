@@ -0,0 +1,22 @@
+package models
+
+// SearchResult - a company matching a search, with its score and the words matched
+// in its name and description wrapped in <mark> tags
+type SearchResult struct {
+	Company    Company    `json:"company"`
+	Score      float64    `json:"score"`
+	Highlights Highlights `json:"highlights"`
+}
+
+// Highlights - the name and an extract of the description of a company, with the
+// words matched by a search marked. The text is HTML escaped, the marks are the only markup.
+type Highlights struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SearchResponse - response structure for a search of the companies, best match first
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
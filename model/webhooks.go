@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeliveryStatus is the state of the delivery of an event to a webhook
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is the dead-letter state of the deliveries out of attempts
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Webhook - a subscription to the company events, posted to its url. No
+// event types means every event. The secret signing the payloads is only
+// sent when the webhook is created.
+type Webhook struct {
+	ID         uuid.UUID   `json:"id"`
+	URL        string      `json:"url"`
+	EventTypes []EventType `json:"event_types"`
+	Secret     string      `json:"secret,omitempty"`
+	CreatedBy  string      `json:"created_by"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// WebhookRequest - request structure to subscribe a webhook
+type WebhookRequest struct {
+	URL        string      `json:"url"`
+	EventTypes []EventType `json:"event_types"`
+}
+
+// WebhookList - response structure for the webhooks
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// WebhookDelivery - an event sent to a webhook, with its attempts newest first
+type WebhookDelivery struct {
+	ID            uuid.UUID         `json:"id"`
+	WebhookID     uuid.UUID         `json:"webhook_id"`
+	EventID       uuid.UUID         `json:"event_id"`
+	EventType     EventType         `json:"event_type"`
+	Status        DeliveryStatus    `json:"status"`
+	AttemptCount  int               `json:"attempt_count"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	LastError     string            `json:"last_error,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	DeliveredAt   *time.Time        `json:"delivered_at,omitempty"`
+	Attempts      []DeliveryAttempt `json:"attempts,omitempty"`
+}
+
+// DeliveryAttempt - one try to post an event to a webhook, the status code is
+// missing when no response was received
+type DeliveryAttempt struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// DeliveryList - response structure for the deliveries of a webhook
+type DeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// PendingDelivery is a delivery claimed by the sender, with what it needs to post it
+type PendingDelivery struct {
+	WebhookDelivery
+	URL     string
+	Secret  string
+	Payload []byte
+}
@@ -3,22 +3,59 @@ package router
 import (
 	"net/http"
 
+	"github.com/jain-chetan/companyservice/auth"
 	middleware "github.com/jain-chetan/companyservice/middleware"
 
 	"github.com/gorilla/mux"
 )
 
 // Router is exported and used in main.go
-func Router() *mux.Router {
+func Router(handler *middleware.Handler) *mux.Router {
 
 	router := mux.NewRouter()
+	router.Use(middleware.RequestID)
+
+	// require wraps the handlers that need a bearer token granting the permission
+	require := func(permission auth.Permission, h http.HandlerFunc) http.Handler {
+		return handler.Auth.Middleware(auth.Require(permission)(h))
+	}
+	// authenticated wraps the handlers that need a bearer token of any user
+	authenticated := func(h http.HandlerFunc) http.Handler {
+		return handler.Auth.Middleware(h)
+	}
+
 	// Serve the Swagger UI
 	router.PathPrefix("/docs").Handler(http.StripPrefix("/docs", middleware.SwaggerHandler()))
-	router.HandleFunc("/createtoken", middleware.CreateToken).Methods("POST")
-	router.HandleFunc("/companies", middleware.CreateCompany).Methods("POST")
-	router.HandleFunc("/companies/{id}", middleware.PatchCompany).Methods("PATCH")
-	router.HandleFunc("/companies/{id}", middleware.GetCompany).Methods("GET")
-	router.HandleFunc("/companies/{id}", middleware.DeleteCompany).Methods("DELETE")
+	router.HandleFunc("/users", handler.CreateUser).Methods("POST")
+	router.Handle("/users/{id}/role", require(auth.ManageUsers, handler.UpdateUserRole)).Methods("PUT")
+	router.HandleFunc("/login", handler.Login).Methods("POST")
+	// kept for the clients written before /login
+	router.HandleFunc("/createtoken", handler.Login).Methods("POST")
+	router.HandleFunc("/token/refresh", handler.RefreshToken).Methods("POST")
+	router.Handle("/logout", authenticated(handler.Logout)).Methods("POST")
+	router.Handle("/tokens/revoke", require(auth.RevokeTokens, handler.RevokeToken)).Methods("POST")
+	router.Handle("/companies", require(auth.WriteCompanies, handler.CreateCompany)).Methods("POST")
+	router.Handle("/companies", require(auth.ReadCompanies, handler.ListCompanies)).Methods("GET")
+	router.Handle("/companies:batch", require(auth.WriteCompanies, handler.BatchCompanies)).Methods("POST")
+	router.Handle("/companies/search", require(auth.ReadCompanies, handler.SearchCompanies)).Methods("GET")
+	router.Handle("/companies/export", require(auth.ReadCompanies, handler.ExportCompanies)).Methods("GET")
+	router.Handle("/companies/import", require(auth.WriteCompanies, handler.ImportCompanies)).Methods("POST")
+	router.Handle("/companies/{id}", require(auth.WriteCompanies, handler.PatchCompany)).Methods("PATCH")
+	router.Handle("/companies/{id}", require(auth.WriteCompanies, handler.PutCompany)).Methods("PUT")
+	router.Handle("/companies/{id}", require(auth.ReadCompanies, handler.GetCompany)).Methods("GET")
+	router.Handle("/companies/{id}", require(auth.DeleteCompanies, handler.DeleteCompany)).Methods("DELETE")
+	router.Handle("/companies/{id}/restore", require(auth.DeleteCompanies, handler.RestoreCompany)).Methods("POST")
+	router.Handle("/companies/{id}/history", require(auth.ReadAudit, handler.CompanyHistory)).Methods("GET")
+	router.Handle("/jobs", require(auth.WriteCompanies, handler.CreateJob)).Methods("POST")
+	router.Handle("/jobs/{id}", require(auth.WriteCompanies, handler.GetJob)).Methods("GET")
+	router.Handle("/jobs/{id}", require(auth.WriteCompanies, handler.CancelJob)).Methods("DELETE")
+	router.Handle("/audit", require(auth.ReadAudit, handler.ListAudit)).Methods("GET")
+	router.Handle("/webhooks", require(auth.ManageWebhooks, handler.CreateWebhook)).Methods("POST")
+	router.Handle("/webhooks", require(auth.ManageWebhooks, handler.ListWebhooks)).Methods("GET")
+	router.Handle("/webhooks/{id}", require(auth.ManageWebhooks, handler.GetWebhook)).Methods("GET")
+	router.Handle("/webhooks/{id}", require(auth.ManageWebhooks, handler.DeleteWebhook)).Methods("DELETE")
+	router.Handle("/webhooks/{id}/deliveries", require(auth.ManageWebhooks, handler.ListDeliveries)).Methods("GET")
+	router.Handle("/webhooks/{id}/deliveries/{delivery_id}/retry", require(auth.ManageWebhooks, handler.RedeliverDelivery)).Methods("POST")
 
 	return router
 }
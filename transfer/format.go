@@ -0,0 +1,69 @@
+package transfer
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+)
+
+// Format is the encoding of the companies exported or imported
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+// Columns are the columns of the CSV files, the fields of models.Company. The id
+// and deleted_at are exported but ignored by the imports, ids differ between environments.
+var Columns = []string{"id", "name", "description", "employees", "registered", "type", "deleted_at"}
+
+// ParseFormat reads the format of a query parameter
+func ParseFormat(value string) (Format, error) {
+	switch f := Format(strings.ToLower(value)); f {
+	case CSV, NDJSON:
+		return f, nil
+	}
+	return "", apperror.New(apperror.Validation, "format must be %s or %s", CSV, NDJSON)
+}
+
+// FormatOf returns the format of a Content-Type
+func FormatOf(contentType string) (Format, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return CSV, true
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return NDJSON, true
+	}
+	return "", false
+}
+
+// ContentType is the media type of the files of a format
+func (f Format) ContentType() string {
+	if f == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// formulaPrefixes start the cells a spreadsheet reads as a formula, a quote is
+// escaped as well so that a cell starting with one round trips
+const formulaPrefixes = "=+-@\t\r'"
+
+// escapeCell prefixes with a quote the text cells a spreadsheet would run as a formula
+func escapeCell(value string) string {
+	if value != "" && strings.IndexByte(formulaPrefixes, value[0]) >= 0 {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCell removes the quote added by escapeCell
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.IndexByte(formulaPrefixes, value[1]) >= 0 {
+		return value[1:]
+	}
+	return value
+}
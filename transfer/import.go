@@ -0,0 +1,173 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
+)
+
+const (
+	// DefaultChunkSize is the number of rows applied in a transaction
+	DefaultChunkSize = 500
+	// MaxImportErrors bounds the errors listed by the report of an import
+	MaxImportErrors = 1000
+)
+
+// Options decide how an import is applied
+type Options struct {
+	// DryRun validates and tries every row, then rolls them back
+	DryRun bool
+	// Upsert replaces the company with the same name instead of failing on it
+	Upsert bool
+	// ChunkSize is the number of rows applied in a transaction, DefaultChunkSize when zero
+	ChunkSize int
+	// Lease, when set, is the lease of the job running the import, its report is saved with every chunk
+	Lease *database.JobLease
+	// Resume is the report saved by a job stopped part way, its rows are read again
+	// for the names they hold but not applied
+	Resume *models.ImportReport
+}
+
+// Import creates the companies read, the rows that fail are reported and left out.
+// A read error or the end of the context stops the import, the report then tells
+// what was applied before it.
+func Import(ctx context.Context, store database.CompanyStore, actor models.Actor, reader Reader, options Options) (models.ImportReport, error) {
+	size := options.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	op := models.BatchCreate
+	if options.Upsert {
+		op = models.BatchUpsert
+	}
+
+	report := models.ImportReport{DryRun: options.DryRun, Errors: []models.ImportError{}}
+	skip := 0
+	if options.Resume != nil {
+		report = *options.Resume
+		report.Errors = append([]models.ImportError{}, report.Errors...)
+		skip = report.Rows
+	}
+	// seen has the line of every name of the file, normalized like the unique index
+	seen := make(map[string]int)
+	var rows []Row
+	var repeated []bool
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		ops := make([]models.CompanyOperation, len(rows))
+		for i := range rows {
+			company := rows[i].Company
+			ops[i] = models.CompanyOperation{Op: op, Company: &company}
+		}
+
+		// the report of the chunk is counted in the transaction of a job, to be saved with it
+		var next models.ImportReport
+		count := func(results []database.OperationResult) models.ImportReport {
+			next = report
+			next.Errors = append([]models.ImportError{}, report.Errors...)
+			for i, result := range results {
+				switch {
+				case result.Err != nil:
+					addError(&next, rows[i], result.Err)
+				// a dry run rolls back every chunk, a name repeated in the file updates the company of its first line
+				case result.Created && !repeated[i]:
+					next.Created++
+				default:
+					next.Updated++
+				}
+			}
+			return next
+		}
+		batchOptions := database.BatchOptions{DryRun: options.DryRun}
+		if options.Lease != nil {
+			batchOptions.Checkpoint = &database.Checkpoint{Lease: *options.Lease, Report: count}
+		}
+
+		results, err := store.BatchCompaniesQuery(actor, ops, batchOptions)
+		if err != nil {
+			return err
+		}
+		if batchOptions.Checkpoint == nil {
+			count(results)
+		}
+		report = next
+		rows, repeated = rows[:0], repeated[:0]
+		return ctx.Err()
+	}
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the rows read before the error are still applied
+			if flushErr := flush(); flushErr != nil {
+				return report, flushErr
+			}
+			return report, err
+		}
+		// a resumed import only reads the rows already counted for their names
+		resumed := line <= skip
+		if !resumed {
+			report.Rows++
+		}
+
+		if row.Err == nil {
+			row.Err = validation.Error(validation.Company(row.Company))
+		}
+		if row.Err != nil {
+			if !resumed {
+				addError(&report, row, row.Err)
+			}
+			continue
+		}
+
+		key := database.NormalizeName(row.Company.Name)
+		first, ok := seen[key]
+		if ok && !options.Upsert {
+			if !resumed {
+				addError(&report, row, apperror.New(apperror.Conflict, "Name not unique, it is also on line %d", first))
+			}
+			continue
+		}
+		if !ok {
+			seen[key] = row.Line
+		}
+		if resumed {
+			continue
+		}
+
+		rows = append(rows, row)
+		repeated = append(repeated, ok)
+		if len(rows) == size {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, flush()
+}
+
+// addError reports the failure of a row, the internal errors are logged
+func addError(report *models.ImportReport, row Row, err error) {
+	report.Failed++
+	problem := apperror.ProblemOf(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Errorf("Line %d of an import failed. %v", row.Line, err)
+	}
+	if len(report.Errors) == MaxImportErrors {
+		report.ErrorsTruncated = true
+		return
+	}
+	report.Errors = append(report.Errors, models.ImportError{Line: row.Line, Name: row.Company.Name, Error: &problem})
+}
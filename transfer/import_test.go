@@ -0,0 +1,187 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// testRow is a row of an import file, employees is written as it is
+type testRow struct {
+	name, typ, employees string
+}
+
+// importFile writes the rows in a format, the lines of an NDJSON file are the ones of
+// the CSV file less one for the header
+func importFile(format Format, rows []testRow) string {
+	var b strings.Builder
+	if format == CSV {
+		b.WriteString("name,type,employees\n")
+	}
+	for _, row := range rows {
+		employees := row.employees
+		if employees == "" {
+			employees = "0"
+		}
+		if format == CSV {
+			fmt.Fprintf(&b, "%s,%s,%s\n", row.name, row.typ, employees)
+			continue
+		}
+		if _, err := fmt.Sscan(employees, new(int)); err != nil {
+			employees = fmt.Sprintf("%q", employees)
+		}
+		fmt.Fprintf(&b, "{\"name\":%q,\"type\":%q,\"employees\":%s}\n", row.name, row.typ, employees)
+	}
+	return b.String()
+}
+
+// importRows imports the rows in a format into the store
+func importRows(t *testing.T, store *database.MemoryStore, format Format, rows []testRow, options Options) models.ImportReport {
+	t.Helper()
+	reader, err := NewReader(format, strings.NewReader(importFile(format, rows)))
+	if err != nil {
+		t.Fatalf("%s reader: %v", format, err)
+	}
+	report, err := Import(context.Background(), store, models.Actor{Subject: "user-1"}, reader, options)
+	if err != nil {
+		t.Fatalf("%s import: %v", format, err)
+	}
+	return report
+}
+
+// companies returns the companies of the store by name
+func companies(t *testing.T, store *database.MemoryStore) map[string]models.Company {
+	t.Helper()
+	list, _, err := store.ListCompaniesQuery(models.CompanyFilter{Limit: 100})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	byName := make(map[string]models.Company)
+	for _, company := range list {
+		byName[company.Name] = company
+	}
+	return byName
+}
+
+// rowError is a failed row expected in a report, by its index in the rows imported
+type rowError struct {
+	index int
+	kind  string
+}
+
+// expectReport fails unless the report has the counts and the errors
+func expectReport(t *testing.T, format Format, got, want models.ImportReport, rows []testRow, errors []rowError) {
+	t.Helper()
+	if got.DryRun != want.DryRun || got.Rows != want.Rows || got.Created != want.Created || got.Updated != want.Updated || got.Failed != want.Failed {
+		t.Errorf("%s: got dry run %t, %d rows, %d created, %d updated, %d failed, want %t, %d, %d, %d, %d", format,
+			got.DryRun, got.Rows, got.Created, got.Updated, got.Failed, want.DryRun, want.Rows, want.Created, want.Updated, want.Failed)
+	}
+	if len(got.Errors) != len(errors) {
+		t.Fatalf("%s: got %d errors, want %d: %+v", format, len(got.Errors), len(errors), got.Errors)
+	}
+	offset := 1
+	if format == CSV {
+		offset = 2
+	}
+	for i, e := range errors {
+		line, kind := e.index+offset, "urn:companyservice:problem:"+e.kind
+		if got.Errors[i].Line != line || got.Errors[i].Name != rows[e.index].name || got.Errors[i].Error == nil || got.Errors[i].Error.Type != kind {
+			t.Errorf("%s: error %d: got line %d of %q with %+v, want line %d of %q with a %s problem", format, i,
+				got.Errors[i].Line, got.Errors[i].Name, got.Errors[i].Error, line, rows[e.index].name, e.kind)
+		}
+	}
+}
+
+func TestImportReportsTheFailedRows(t *testing.T) {
+	rows := []testRow{
+		{"Acme", "Corporation", "12"},
+		{"Globex", "Guild", ""},
+		{"Initech", "NonProfit", ""},
+		{"", "Corporation", ""},
+		{"Umbrella", "Corporation", "many"},
+		// a name repeated in the file, even in another case, fails the rows after the first
+		{"ACME", "Corporation", ""},
+		{"Hooli", "Corporation", ""},
+	}
+	for _, format := range []Format{CSV, NDJSON} {
+		store := database.NewMemoryStore()
+		if _, err := store.CreateCompanyQuery(models.Actor{}, models.Company{Name: "Hooli", Type: models.Corporation}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+
+		// the chunks are smaller than the file so that the report adds them up
+		report := importRows(t, store, format, rows, Options{ChunkSize: 2})
+		expectReport(t, format, report, models.ImportReport{Rows: 7, Created: 2, Failed: 5}, rows,
+			[]rowError{{1, "validation"}, {3, "validation"}, {4, "validation"}, {5, "conflict"}, {6, "conflict"}})
+
+		byName := companies(t, store)
+		if len(byName) != 3 || byName["Acme"].Employees != 12 || byName["Initech"].Type != models.NonProfit {
+			t.Errorf("%s: got the companies %+v, want Acme, Initech and Hooli", format, byName)
+		}
+	}
+}
+
+func TestImportUpsert(t *testing.T) {
+	rows := []testRow{
+		{"Acme", "Corporation", "5"},
+		{"Globex", "Corporation", "1"},
+		// the repeated name updates the company of its first line
+		{"globex", "Corporation", "7"},
+		{"Initech", "Guild", ""},
+	}
+	for _, format := range []Format{CSV, NDJSON} {
+		store := database.NewMemoryStore()
+		if _, err := store.CreateCompanyQuery(models.Actor{}, models.Company{Name: "Acme", Employees: 1, Type: models.Corporation}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+
+		report := importRows(t, store, format, rows, Options{Upsert: true})
+		expectReport(t, format, report, models.ImportReport{Rows: 4, Created: 1, Updated: 2, Failed: 1}, rows, []rowError{{3, "validation"}})
+
+		byName := companies(t, store)
+		if len(byName) != 2 || byName["Acme"].Employees != 5 || byName["globex"].Employees != 7 {
+			t.Errorf("%s: got the companies %+v, want Acme with 5 employees and globex with 7", format, byName)
+		}
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	rows := []testRow{
+		{"Acme", "Corporation", ""},
+		{"Globex", "Corporation", ""},
+		{"Globex", "Corporation", ""},
+		{"Initech", "Guild", ""},
+		{"Umbrella", "Corporation", ""},
+	}
+	for _, format := range []Format{CSV, NDJSON} {
+		store := database.NewMemoryStore()
+
+		// every chunk is rolled back, the report is the one of the import done for real
+		report := importRows(t, store, format, rows, Options{DryRun: true, ChunkSize: 2})
+		expectReport(t, format, report, models.ImportReport{DryRun: true, Rows: 5, Created: 3, Failed: 2}, rows,
+			[]rowError{{2, "conflict"}, {3, "validation"}})
+		if byName := companies(t, store); len(byName) != 0 {
+			t.Errorf("%s: got the companies %+v of a dry run", format, byName)
+		}
+
+		report = importRows(t, store, format, rows, Options{ChunkSize: 2})
+		expectReport(t, format, report, models.ImportReport{Rows: 5, Created: 3, Failed: 2}, rows,
+			[]rowError{{2, "conflict"}, {3, "validation"}})
+	}
+}
+
+func TestImportTruncatesTheErrors(t *testing.T) {
+	rows := make([]testRow, MaxImportErrors+5)
+	for i := range rows {
+		rows[i] = testRow{fmt.Sprintf("Company %d", i), "Guild", ""}
+	}
+	report := importRows(t, database.NewMemoryStore(), NDJSON, rows, Options{})
+	if report.Failed != len(rows) || len(report.Errors) != MaxImportErrors || !report.ErrorsTruncated {
+		t.Errorf("got %d failed with %d errors listed, truncated %t, want %d failed with %d listed and truncated",
+			report.Failed, len(report.Errors), report.ErrorsTruncated, len(rows), MaxImportErrors)
+	}
+}
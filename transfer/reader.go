@@ -0,0 +1,180 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
+
+	"github.com/google/uuid"
+)
+
+// MaxLineLength bounds a line of an NDJSON file
+const MaxLineLength = 1 << 20
+
+// Row is a company read from an import, or the error of its line
+type Row struct {
+	Line    int
+	Company models.Company
+	Err     error
+}
+
+// Reader decodes the companies of an import one at a time. Read returns io.EOF
+// after the last row, any other error stops the import.
+type Reader interface {
+	Read() (Row, error)
+}
+
+// NewReader returns the reader of a format from r, the header of a CSV file is read right away
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	if format == NDJSON {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength)
+		return &ndjsonReader{scanner: scanner}, nil
+	}
+	return newCSVReader(r)
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	// columns has the index of every column of the file, by name
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, apperror.New(apperror.Validation, "The CSV file is empty, it needs a header")
+	}
+	if err != nil {
+		return nil, readError(err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// spreadsheets often start the file with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !knownColumn(name) {
+			return nil, apperror.New(apperror.Validation, "Unknown column %q, the columns are %s", name, strings.Join(Columns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, apperror.New(apperror.Validation, "Column %q is repeated", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, apperror.New(apperror.Validation, "The CSV file needs a name column")
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func knownColumn(name string) bool {
+	for _, column := range Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *csvReader) Read() (Row, error) {
+	record, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case err == io.EOF:
+		return Row{}, err
+	case errors.As(err, &parseErr):
+		// the reader goes on with the next record
+		return Row{Line: parseErr.StartLine, Err: apperror.New(apperror.Validation, "Invalid CSV: %v", parseErr.Err)}, nil
+	case err != nil:
+		return Row{}, readError(err)
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	row := Row{Line: line}
+	if len(record) != len(c.columns) {
+		row.Err = apperror.New(apperror.Validation, "The row has %d fields, the header %d", len(record), len(c.columns))
+		return row, nil
+	}
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	row.Company = models.Company{
+		Name:        unescapeCell(field("name")),
+		Description: unescapeCell(field("description")),
+		Type:        models.CompanyType(field("type")),
+	}
+
+	var violations []models.FieldError
+	if v := strings.TrimSpace(field("employees")); v != "" {
+		employees, err := strconv.Atoi(v)
+		if err != nil {
+			violations = append(violations, models.FieldError{Field: "employees", Code: validation.CodeFormat, Message: fmt.Sprintf("employees %q is not a number", v)})
+		}
+		row.Company.Employees = employees
+	}
+	if v := strings.TrimSpace(field("registered")); v != "" {
+		registered, err := strconv.ParseBool(v)
+		if err != nil {
+			violations = append(violations, models.FieldError{Field: "registered", Code: validation.CodeFormat, Message: fmt.Sprintf("registered %q is not true or false", v)})
+		}
+		row.Company.Registered = registered
+	}
+	row.Err = validation.Error(violations)
+	return row, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonReader) Read() (Row, error) {
+	for n.scanner.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := Row{Line: n.line}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.Company); err != nil {
+			row.Err = apperror.New(apperror.Validation, "Invalid JSON: %v", err)
+			return row, nil
+		}
+		// the id and deleted_at of an export are left to the environment imported into
+		row.Company.ID, row.Company.DeletedAt = uuid.Nil, nil
+		return row, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return Row{}, apperror.New(apperror.Validation, "Line %d is longer than %d bytes", n.line+1, MaxLineLength)
+		}
+		return Row{}, readError(err)
+	}
+	return Row{}, io.EOF
+}
+
+// readError reports a body that can't be read, it is the client's
+func readError(err error) error {
+	return apperror.Wrap(apperror.Validation, err, "Unable to read the file")
+}
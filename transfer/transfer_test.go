@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	companies := []models.Company{
+		{ID: uuid.New(), Name: "=HYPERLINK(\"http://evil\")", Description: "+1 for anvils", Type: models.Corporation},
+		{ID: uuid.New(), Name: "-Minus", Description: "@SUM(A1:A9)", Type: models.Corporation},
+		{ID: uuid.New(), Name: "'Quoted", Description: "\tTabbed", Type: models.Corporation},
+		{ID: uuid.New(), Name: "Acme", Description: "Anvils = tools", Type: models.Corporation},
+	}
+
+	var buf bytes.Buffer
+	writer := NewWriter(CSV, &buf)
+	for _, company := range companies {
+		if err := writer.Write(company); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	for _, cell := range []string{`"'=HYPERLINK(""http://evil"")"`, "'+1 for anvils", "'-Minus", "'@SUM(A1:A9)", "''Quoted", "Anvils = tools"} {
+		if !strings.Contains(buf.String(), ","+cell+",") {
+			t.Errorf("the export has no cell %s:\n%s", cell, buf.String())
+		}
+	}
+
+	reader, err := NewReader(CSV, &buf)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	for _, want := range companies {
+		row, err := reader.Read()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if row.Err != nil {
+			t.Fatalf("line %d: %v", row.Line, row.Err)
+		}
+		if row.Company.Name != want.Name || row.Company.Description != want.Description {
+			t.Errorf("line %d: got %q, %q, want %q, %q", row.Line, row.Company.Name, row.Company.Description, want.Name, want.Description)
+		}
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("got %v after the last row, want io.EOF", err)
+	}
+}
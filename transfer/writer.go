@@ -0,0 +1,84 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Writer encodes the companies of an export one at a time
+type Writer interface {
+	Write(company models.Company) error
+	// Flush writes what is buffered, the CSV header included when no company was written
+	Flush() error
+}
+
+// NewWriter returns the writer of a format to w
+func NewWriter(format Format, w io.Writer) Writer {
+	if format == NDJSON {
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}
+	}
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+	record []string
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.writer.Write(Columns)
+}
+
+func (c *csvWriter) Write(company models.Company) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	var deletedAt string
+	if company.DeletedAt != nil {
+		deletedAt = company.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	c.record = append(c.record[:0],
+		company.ID.String(),
+		escapeCell(company.Name),
+		escapeCell(company.Description),
+		strconv.Itoa(company.Employees),
+		strconv.FormatBool(company.Registered),
+		string(company.Type),
+		deletedAt,
+	)
+	return c.writer.Write(c.record)
+}
+
+func (c *csvWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+// Write encodes the company on its own line, json.Encoder ends every value with a newline
+func (n *ndjsonWriter) Write(company models.Company) error {
+	return n.encoder.Encode(company)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buffered.Flush()
+}
@@ -0,0 +1,113 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+const (
+	MaxNameLength        = 100
+	MaxDescriptionLength = 3000
+)
+
+// the codes of the violations
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeCharset    = "invalid_characters"
+	CodeWhitespace = "surrounding_whitespace"
+	CodeEnum       = "not_allowed"
+	CodeNegative   = "negative"
+	CodeEncoding   = "invalid_encoding"
+	CodeURL        = "invalid_url"
+	CodeFormat     = "invalid_format"
+	CodeAddress    = "forbidden_address"
+)
+
+// CompanyTypes are the values allowed for the type of a company
+var CompanyTypes = []models.CompanyType{
+	models.Corporation,
+	models.NonProfit,
+	models.Cooperative,
+	models.SoleProprietorship,
+}
+
+// namePunctuation is the punctuation allowed in a name besides letters, digits, marks and spaces
+const namePunctuation = "&.,'-()/+!@#"
+
+// ValidCompanyType reports whether a type is one of CompanyTypes
+func ValidCompanyType(t models.CompanyType) bool {
+	for _, allowed := range CompanyTypes {
+		if t == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Company returns every rule a company breaks, or nothing when it can be stored
+func Company(company models.Company) []models.FieldError {
+	var violations []models.FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		violations = append(violations, models.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch name := company.Name; {
+	case strings.TrimSpace(name) == "":
+		add("name", CodeRequired, "name is required")
+	case !utf8.ValidString(name):
+		add("name", CodeEncoding, "name must be valid UTF-8")
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		add("name", CodeTooLong, "name must be at most %d characters", MaxNameLength)
+	case strings.TrimSpace(name) != name:
+		add("name", CodeWhitespace, "name must not start or end with whitespace")
+	default:
+		for _, r := range name {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != ' ' && !strings.ContainsRune(namePunctuation, r) {
+				add("name", CodeCharset, "name must only contain letters, digits, spaces and %s, not %q", namePunctuation, r)
+				break
+			}
+		}
+	}
+
+	switch description := company.Description; {
+	case !utf8.ValidString(description):
+		add("description", CodeEncoding, "description must be valid UTF-8")
+	case utf8.RuneCountInString(description) > MaxDescriptionLength:
+		add("description", CodeTooLong, "description must be at most %d characters", MaxDescriptionLength)
+	}
+
+	if company.Employees < 0 {
+		add("employees", CodeNegative, "employees must not be negative")
+	}
+
+	switch {
+	case company.Type == "":
+		add("type", CodeRequired, "type is required")
+	case !ValidCompanyType(company.Type):
+		add("type", CodeEnum, "type must be one of %s", typeList())
+	}
+
+	return violations
+}
+
+// Error returns the validation error listing the violations in its errors member, or nil when there is none
+func Error(violations []models.FieldError) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return apperror.New(apperror.Validation, "The company is not valid").With("errors", violations)
+}
+
+func typeList() string {
+	names := make([]string, len(CompanyTypes))
+	for i, t := range CompanyTypes {
+		names[i] = fmt.Sprintf("%q", t)
+	}
+	return strings.Join(names, ", ")
+}
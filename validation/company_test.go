@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// violation is a field and the code of the rule it breaks
+type violation struct {
+	field, code string
+}
+
+func TestCompany(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *models.Company)
+		want   []violation
+	}{
+		{"valid", func(c *models.Company) {}, nil},
+		{"every type", func(c *models.Company) { c.Type = models.SoleProprietorship }, nil},
+		{"punctuation", func(c *models.Company) { c.Name = "A&B (Holdings), Ltd. - R+D / O'Brien #1 @home!" }, nil},
+		{"letters of every script", func(c *models.Company) { c.Name = "Société Générale Łódź 東京電力 Ελλάδα" }, nil},
+		{"combining marks", func(c *models.Company) { c.Name = "Cafe\u0301" }, nil},
+		{"name of the maximum length", func(c *models.Company) { c.Name = strings.Repeat("é", MaxNameLength) }, nil},
+		{"description of the maximum length", func(c *models.Company) { c.Description = strings.Repeat("東", MaxDescriptionLength) }, nil},
+		{"description with any character", func(c *models.Company) { c.Description = "  <b>Anvils</b>\n\t; DROP TABLE company; -- " }, nil},
+
+		{"empty name", func(c *models.Company) { c.Name = "" }, []violation{{"name", CodeRequired}}},
+		{"blank name", func(c *models.Company) { c.Name = " \t\n" }, []violation{{"name", CodeRequired}}},
+		{"name too long", func(c *models.Company) { c.Name = strings.Repeat("é", MaxNameLength+1) }, []violation{{"name", CodeTooLong}}},
+		{"leading space", func(c *models.Company) { c.Name = " Acme" }, []violation{{"name", CodeWhitespace}}},
+		{"trailing space", func(c *models.Company) { c.Name = "Acme " }, []violation{{"name", CodeWhitespace}}},
+		{"trailing tab", func(c *models.Company) { c.Name = "Acme\t" }, []violation{{"name", CodeWhitespace}}},
+		{"trailing newline", func(c *models.Company) { c.Name = "Acme\n" }, []violation{{"name", CodeWhitespace}}},
+		{"inner tab", func(c *models.Company) { c.Name = "Ac\tme" }, []violation{{"name", CodeCharset}}},
+		{"control character", func(c *models.Company) { c.Name = "Ac\x00me" }, []violation{{"name", CodeCharset}}},
+		{"markup", func(c *models.Company) { c.Name = "<script>" }, []violation{{"name", CodeCharset}}},
+		{"semicolon", func(c *models.Company) { c.Name = "Acme; DROP TABLE company" }, []violation{{"name", CodeCharset}}},
+		{"emoji", func(c *models.Company) { c.Name = "Acme 🚀" }, []violation{{"name", CodeCharset}}},
+		{"zero width space", func(c *models.Company) { c.Name = "Ac\u200bme" }, []violation{{"name", CodeCharset}}},
+		{"invalid UTF-8 name", func(c *models.Company) { c.Name = "Acme \xff" }, []violation{{"name", CodeEncoding}}},
+		{"truncated UTF-8 name", func(c *models.Company) { c.Name = "Soci\xc3" }, []violation{{"name", CodeEncoding}}},
+
+		{"description too long", func(c *models.Company) { c.Description = strings.Repeat("a", MaxDescriptionLength+1) }, []violation{{"description", CodeTooLong}}},
+		{"invalid UTF-8 description", func(c *models.Company) { c.Description = "Anvils \xe2\x82" }, []violation{{"description", CodeEncoding}}},
+
+		{"negative employees", func(c *models.Company) { c.Employees = -1 }, []violation{{"employees", CodeNegative}}},
+
+		{"no type", func(c *models.Company) { c.Type = "" }, []violation{{"type", CodeRequired}}},
+		{"unknown type", func(c *models.Company) { c.Type = "Guild" }, []violation{{"type", CodeEnum}}},
+		{"type in another case", func(c *models.Company) { c.Type = "corporation" }, []violation{{"type", CodeEnum}}},
+		{"type with spaces", func(c *models.Company) { c.Type = " Corporation" }, []violation{{"type", CodeEnum}}},
+
+		// every field is checked, a name breaks one rule at most
+		{"every field", func(c *models.Company) {
+			*c = models.Company{Name: " <Acme> ", Description: "\xff", Employees: -5, Type: "Guild"}
+		}, []violation{{"name", CodeWhitespace}, {"description", CodeEncoding}, {"employees", CodeNegative}, {"type", CodeEnum}}},
+	}
+	for _, test := range tests {
+		company := models.Company{Name: "Acme", Description: "Anvils", Employees: 12, Type: models.Corporation}
+		test.change(&company)
+
+		got := Company(company)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got the violations %+v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if got[i].Field != want.field || got[i].Code != want.code || got[i].Message == "" {
+				t.Errorf("%s: violation %d: got %+v, want %s %s with a message", test.name, i, got[i], want.field, want.code)
+			}
+		}
+	}
+}
+
+func TestValidCompanyType(t *testing.T) {
+	for _, typ := range CompanyTypes {
+		if !ValidCompanyType(typ) {
+			t.Errorf("%q: got invalid, want valid", typ)
+		}
+	}
+	for _, typ := range []models.CompanyType{"", "Guild", "corporation", "Corporation "} {
+		if ValidCompanyType(typ) {
+			t.Errorf("%q: got valid, want invalid", typ)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	if err := Error(nil); err != nil {
+		t.Errorf("no violation: got %v, want nil", err)
+	}
+
+	violations := Company(models.Company{Type: models.Corporation})
+	var appErr *apperror.Error
+	if err := Error(violations); !errors.As(err, &appErr) || appErr.Kind != apperror.Validation {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+	if got, ok := appErr.Extensions["errors"].([]models.FieldError); !ok || len(got) != 1 || got[0].Field != "name" {
+		t.Errorf("got the errors member %+v, want the violation of the name", appErr.Extensions["errors"])
+	}
+}
@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// MaxURLLength bounds the urls of the webhooks
+const MaxURLLength = 2048
+
+// reservedNetworks are the networks a webhook may not reach besides the loopback, link-local
+// and private ones: this network, the carrier-grade NAT where some clouds keep their metadata
+// endpoint, the IETF protocol assignments, the benchmarking and reserved ranges with the
+// broadcast address, and the NAT64 prefixes that would lead to any of them
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+)
+
+// metadataHosts are the names of the metadata endpoints of the clouds
+var metadataHosts = map[string]bool{
+	"metadata":                 true,
+	"metadata.google.internal": true,
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// PublicAddress reports whether a webhook may be delivered to an ip, which rules out the
+// service itself, the networks around it and the metadata endpoints of the clouds
+func PublicAddress(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost reports whether the host of a url may be a webhook, the names are resolved
+// when the deliveries are made and their addresses checked then
+func publicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || metadataHosts[host] {
+		return false
+	}
+	// a zone is only given to the link-local addresses
+	if strings.Contains(host, "%") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return PublicAddress(ip)
+	}
+	return true
+}
+
+// Webhook returns every violation of the rules of a webhook subscription
+func Webhook(req models.WebhookRequest) []models.FieldError {
+	var violations []models.FieldError
+
+	switch u, err := url.Parse(req.URL); {
+	case req.URL == "":
+		violations = append(violations, models.FieldError{Field: "url", Code: CodeRequired, Message: "url is required"})
+	case len(req.URL) > MaxURLLength:
+		violations = append(violations, models.FieldError{Field: "url", Code: CodeTooLong, Message: fmt.Sprintf("url must be at most %d characters", MaxURLLength)})
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		violations = append(violations, models.FieldError{Field: "url", Code: CodeURL, Message: "url must be an absolute http or https url"})
+	case !publicHost(u.Hostname()):
+		violations = append(violations, models.FieldError{Field: "url", Code: CodeAddress, Message: "url must not point at a loopback, link-local, private or metadata address"})
+	}
+
+	for _, t := range req.EventTypes {
+		if !validEventType(t) {
+			violations = append(violations, models.FieldError{
+				Field:   "event_types",
+				Code:    CodeEnum,
+				Message: fmt.Sprintf("%q is not one of %v", t, models.EventTypes),
+			})
+		}
+	}
+	return violations
+}
+
+func validEventType(t models.EventType) bool {
+	for _, known := range models.EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookError returns the validation error listing the violations of a webhook, nil without any
+func WebhookError(violations []models.FieldError) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return apperror.New(apperror.Validation, "The webhook is not valid").With("errors", violations)
+}
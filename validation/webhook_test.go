@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		url        string
+		eventTypes []models.EventType
+		want       []violation
+	}{
+		{"https://hooks.example.com/companies", nil, nil},
+		{"http://hooks.example.com:8080/companies?token=abc", []models.EventType{models.CompanyCreated, models.CompanyDeleted}, nil},
+		{"https://93.184.216.34/hooks", nil, nil},
+		{"https://[2606:2800:220:1:248:1893:25c8:1946]/hooks", nil, nil},
+		// the names are resolved at the delivery, not here
+		{"https://internal.example.com/hooks", nil, nil},
+
+		{"", nil, []violation{{"url", CodeRequired}}},
+		{"https://example.com/" + strings.Repeat("a", MaxURLLength), nil, []violation{{"url", CodeTooLong}}},
+		{"ftp://hooks.example.com", nil, []violation{{"url", CodeURL}}},
+		{"/hooks", nil, []violation{{"url", CodeURL}}},
+		{"https://", nil, []violation{{"url", CodeURL}}},
+		{"https://hooks example.com", nil, []violation{{"url", CodeURL}}},
+
+		{"http://localhost:8080/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://LOCALHOST./hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://api.localhost/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://127.0.0.1/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://127.1.2.3/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://[::1]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://[::ffff:127.0.0.1]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://0.0.0.0/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://[::]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://10.0.0.5/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://172.16.3.4/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://192.168.1.1/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://[fd00::1]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://169.254.169.254/latest/meta-data/", nil, []violation{{"url", CodeAddress}}},
+		{"http://[fd00:ec2::254]/latest/meta-data/", nil, []violation{{"url", CodeAddress}}},
+		{"http://100.100.100.200/latest/meta-data/", nil, []violation{{"url", CodeAddress}}},
+		{"http://metadata.google.internal/computeMetadata/v1/", nil, []violation{{"url", CodeAddress}}},
+		{"http://[fe80::1%25eth0]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://[64:ff9b::a9fe:a9fe]/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://224.0.0.1/hooks", nil, []violation{{"url", CodeAddress}}},
+		{"http://255.255.255.255/hooks", nil, []violation{{"url", CodeAddress}}},
+
+		{"https://hooks.example.com", []models.EventType{"CompanyRenamed", models.CompanyCreated, "companycreated"},
+			[]violation{{"event_types", CodeEnum}, {"event_types", CodeEnum}}},
+		{"http://10.0.0.5", []models.EventType{"CompanyRenamed"}, []violation{{"url", CodeAddress}, {"event_types", CodeEnum}}},
+	}
+	for _, test := range tests {
+		got := Webhook(models.WebhookRequest{URL: test.url, EventTypes: test.eventTypes})
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got the violations %+v, want %v", test.url, got, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if got[i].Field != want.field || got[i].Code != want.code || got[i].Message == "" {
+				t.Errorf("%q: violation %d: got %+v, want %s %s with a message", test.url, i, got[i], want.field, want.code)
+			}
+		}
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:10.1.2.3", false},
+		{"0.1.2.3", false},
+		{"10.255.255.255", false},
+		{"172.31.0.1", false},
+		{"192.168.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"100.64.0.1", false},
+		{"192.0.0.192", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"ff02::1", false},
+		{"64:ff9b::7f00:1", false},
+	}
+	for _, test := range tests {
+		if got := PublicAddress(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("%s: got public %t, want %t", test.ip, got, test.want)
+		}
+	}
+}
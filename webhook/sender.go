@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/validation"
+)
+
+// Sender posts the pending deliveries to the webhooks, retrying the failed ones
+// with an exponential backoff until they run out of attempts and are dead
+type Sender struct {
+	Store database.WebhookStore
+	// Client should not follow redirects, see NewClient
+	Client *http.Client
+	// MaxAttempts is the number of attempts before a delivery is dead
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled for every next one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	BatchSize  int
+}
+
+// ErrForbiddenAddress fails the attempts to deliver to an address that is not public
+var ErrForbiddenAddress = errors.New("the webhook resolves to a loopback, link-local, private or metadata address")
+
+// NewClient returns the client of the deliveries. It doesn't follow redirects, a webhook
+// answering 3xx fails the attempt so that the signed payloads only go to the url subscribed.
+// It only connects to public addresses, checked once the name of the webhook is resolved so
+// that a name pointed at the network of the service after its validation is refused too,
+// and it goes through no proxy since a proxy would resolve the name out of its sight.
+func NewClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, validation.PublicAddress)
+}
+
+// newClient returns the client of the deliveries connecting to the addresses allowed only
+func newClient(timeout time.Duration, allowed func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("%s: %w", host, ErrForbiddenAddress)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Run posts the deliveries due, a batch at a time until none is left, for worker.Every
+func (s *Sender) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// the lease covers the requests of the batch, made in parallel
+		deliveries, err := s.Store.ClaimDeliveriesQuery(s.BatchSize, s.Client.Timeout+time.Minute)
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for _, d := range deliveries {
+			wg.Add(1)
+			go func(d models.PendingDelivery) {
+				defer wg.Done()
+				s.deliver(ctx, d)
+			}(d)
+		}
+		wg.Wait()
+
+		if len(deliveries) < s.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliver makes one attempt of a delivery and records it
+func (s *Sender) deliver(ctx context.Context, d models.PendingDelivery) {
+	start := time.Now()
+	attempt := models.DeliveryAttempt{
+		Attempt:     d.AttemptCount + 1,
+		AttemptedAt: start,
+	}
+	attempt.StatusCode, attempt.Error = s.post(ctx, d)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+
+	// a delivery interrupted by the shutdown is left to its lease and tried again
+	if ctx.Err() != nil {
+		return
+	}
+
+	status := models.DeliveryDelivered
+	var next *time.Time
+	if attempt.Error != "" {
+		status = models.DeliveryDead
+		if attempt.Attempt < s.MaxAttempts {
+			status = models.DeliveryPending
+			at := time.Now().Add(Backoff(attempt.Attempt, s.Backoff, s.MaxBackoff))
+			next = &at
+		} else {
+			logger.Warnf("Delivery %s of event %s to webhook %s is dead after %d attempts. %s", d.ID, d.EventID, d.WebhookID, attempt.Attempt, attempt.Error)
+		}
+	}
+
+	if err := s.Store.RecordDeliveryAttemptQuery(d.ID, attempt, status, next); err != nil {
+		logger.Errorf("Unable to record the attempt of delivery %s. %v", d.ID, err)
+	}
+}
+
+// post sends the payload of a delivery, signed, and returns the status code
+// received and the error of a failure
+func (s *Sender) post(ctx context.Context, d models.PendingDelivery) (int, string) {
+	// the urls are checked when the webhooks are created, this guards the ones stored before
+	if u, err := url.Parse(d.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, "not an absolute http or https url"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "companyservice-webhooks")
+	req.Header.Set(HeaderDeliveryID, d.ID.String())
+	req.Header.Set(HeaderEvent, string(d.EventType))
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(now.Unix()))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, now, d.Payload))
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer res.Body.Close()
+	// drain the body so that the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, "unexpected status " + res.Status
+	}
+	return res.StatusCode, ""
+}
+
+// Backoff returns the delay after a failed attempt, base doubled for every attempt
+// before it up to max, with up to a fifth of jitter so that the retries spread out
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if jitter := int64(d / 5); jitter > 0 {
+		d += time.Duration(rand.Int63n(jitter))
+	}
+	return d
+}
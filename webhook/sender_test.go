@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+const testSecret = "whsec_test"
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"CompanyCreated"}`)
+	signature := Sign(testSecret, now, body)
+	if !strings.HasPrefix(signature, "v1=") {
+		t.Fatalf("got signature %q, want a v1= prefix", signature)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		want      error
+	}{
+		{"valid", timestamp, signature, body, now, nil},
+		{"rotated secrets", timestamp, Sign("whsec_old", now, body) + ", " + signature, body, now, nil},
+		{"within tolerance", timestamp, signature, body, now.Add(4 * time.Minute), nil},
+		{"tampered body", timestamp, signature, []byte(`{"type":"CompanyDeleted"}`), now, ErrInvalidSignature},
+		{"other secret", timestamp, Sign("whsec_other", now, body), body, now, ErrInvalidSignature},
+		{"other timestamp", strconv.FormatInt(now.Unix()+1, 10), signature, body, now, ErrInvalidSignature},
+		{"replayed", timestamp, signature, body, now.Add(6 * time.Minute), ErrStaleTimestamp},
+		{"no signature", timestamp, "", body, now, ErrMissingSignature},
+		{"bad timestamp", "yesterday", signature, body, now, ErrMissingSignature},
+	}
+	for _, test := range tests {
+		err := Verify(testSecret, test.timestamp, test.signature, test.body, 5*time.Minute, test.now)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := time.Second, 30*time.Second
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: 16 * time.Second, 6: max, 20: max} {
+		// the jitter adds up to a fifth
+		if got := Backoff(attempt, base, max); got < want || got >= want+want/5 {
+			t.Errorf("attempt %d: got %v, want %v plus up to a fifth", attempt, got, want)
+		}
+	}
+}
+
+// receiver is a webhook answering with the statuses in turn, the last one once they run out
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	requests int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := Verify(testSecret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+		rc.t.Errorf("delivery %s: %v", r.Header.Get(HeaderDeliveryID), err)
+	}
+	if r.Header.Get(HeaderEvent) != string(models.CompanyCreated) {
+		rc.t.Errorf("got event header %q, want %s", r.Header.Get(HeaderEvent), models.CompanyCreated)
+	}
+
+	rc.mu.Lock()
+	status := rc.statuses[len(rc.statuses)-1]
+	if rc.requests < len(rc.statuses) {
+		status = rc.statuses[rc.requests]
+	}
+	rc.requests++
+	rc.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests
+}
+
+// loopbackClient is a client of the deliveries allowed to reach the test servers
+func loopbackClient() *http.Client {
+	return newClient(time.Second, func(ip net.IP) bool { return ip.IsLoopback() })
+}
+
+// deliverEvent subscribes a webhook to url, enqueues an event and runs the sender with the client
+// until the delivery is no longer pending, it returns the delivery
+func deliverEvent(t *testing.T, client *http.Client, url string, maxAttempts int) models.WebhookDelivery {
+	t.Helper()
+	store := database.NewMemoryStore()
+	webhook, err := store.CreateWebhookQuery(models.Webhook{URL: url, Secret: testSecret})
+	if err != nil {
+		t.Fatalf("create the webhook: %v", err)
+	}
+	event := models.Event{ID: uuid.New(), Type: models.CompanyCreated, CompanyID: uuid.New(), OccurredAt: time.Now()}
+	if err := (Sink{Store: store}).Publish(context.Background(), event); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	sender := &Sender{
+		Store:       store,
+		Client:      client,
+		MaxAttempts: maxAttempts,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		BatchSize:   10,
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := sender.Run(context.Background()); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		deliveries, err := store.ListDeliveriesQuery(webhook.ID, "", 10)
+		if err != nil {
+			t.Fatalf("list the deliveries: %v", err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		if deliveries[0].Status != models.DeliveryPending {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the delivery is still pending after %d attempts", deliveries[0].AttemptCount)
+		}
+		time.Sleep(3 * time.Millisecond)
+	}
+}
+
+func TestSenderRetriesServerErrors(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	delivery := deliverEvent(t, loopbackClient(), server.URL, 5)
+	if delivery.Status != models.DeliveryDelivered || delivery.AttemptCount != 3 || delivery.DeliveredAt == nil {
+		t.Fatalf("got %s after %d attempts, want delivered after 3", delivery.Status, delivery.AttemptCount)
+	}
+	// the attempts are listed newest first
+	for i, want := range []int{http.StatusNoContent, http.StatusBadGateway, http.StatusInternalServerError} {
+		if got := delivery.Attempts[i].StatusCode; got != want {
+			t.Errorf("attempt %d: got status %d, want %d", delivery.Attempts[i].Attempt, got, want)
+		}
+	}
+	if rc.count() != 3 {
+		t.Errorf("got %d requests, want 3", rc.count())
+	}
+}
+
+func TestSenderDeadLetters(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	delivery := deliverEvent(t, loopbackClient(), server.URL, 3)
+	if delivery.Status != models.DeliveryDead || delivery.AttemptCount != 3 {
+		t.Fatalf("got %s after %d attempts, want dead after 3", delivery.Status, delivery.AttemptCount)
+	}
+	if delivery.NextAttemptAt != nil || delivery.LastError == "" {
+		t.Errorf("got next attempt %v and last error %q, want no next attempt and the error", delivery.NextAttemptAt, delivery.LastError)
+	}
+	if rc.count() != 3 {
+		t.Errorf("got %d requests, want 3", rc.count())
+	}
+}
+
+func TestSenderDoesNotFollowRedirects(t *testing.T) {
+	target := &receiver{t: t, statuses: []int{http.StatusOK}}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+	server := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	delivery := deliverEvent(t, loopbackClient(), server.URL, 1)
+	if delivery.Status != models.DeliveryDead || delivery.Attempts[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("got %s with status %d, want dead with the redirect status", delivery.Status, delivery.Attempts[0].StatusCode)
+	}
+	if target.count() != 0 {
+		t.Errorf("the redirect was followed")
+	}
+}
+
+func TestSenderRefusesOtherSchemes(t *testing.T) {
+	delivery := deliverEvent(t, loopbackClient(), "file:///etc/passwd", 1)
+	if delivery.Status != models.DeliveryDead || delivery.Attempts[0].StatusCode != 0 {
+		t.Errorf("got %s with status %d, want dead without a response", delivery.Status, delivery.Attempts[0].StatusCode)
+	}
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	// the address is checked once the name is resolved, a name of the loopback is refused as well
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		delivery := deliverEvent(t, NewClient(time.Second), url, 1)
+		if delivery.Status != models.DeliveryDead || delivery.Attempts[0].StatusCode != 0 ||
+			!strings.Contains(delivery.LastError, ErrForbiddenAddress.Error()) {
+			t.Errorf("%s: got %s with status %d and error %q, want dead on the forbidden address", url,
+				delivery.Status, delivery.Attempts[0].StatusCode, delivery.LastError)
+		}
+	}
+	if rc.count() != 0 {
+		t.Errorf("got %d requests, want none", rc.count())
+	}
+}
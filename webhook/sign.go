@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers of the requests posted to the webhooks
+const (
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// signatureVersion prefixes the signatures so that the scheme can change without breaking the receivers
+const signatureVersion = "v1"
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature or timestamp")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp out of tolerance")
+)
+
+// NewSecret returns a random secret to sign the payloads of a webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of a payload sent at a time: the HMAC-SHA256 with the
+// secret of the unix timestamp, a dot and the body, hex encoded after "v1="
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a payload received, the
+// timestamp must be within tolerance of now so that a request can't be replayed later
+func Verify(secret, timestampHeader, signatureHeader string, body []byte, tolerance time.Duration, now time.Time) error {
+	if timestampHeader == "" || signatureHeader == "" {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := now.Sub(timestamp); d > tolerance || d < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	expected := Sign(secret, timestamp, body)
+	// several signatures are accepted, separated by commas, for the rotation of the secrets
+	for _, signature := range strings.Split(signatureHeader, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(signature)), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,19 @@
+package webhook
+
+import (
+	"context"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+)
+
+// Sink enqueues a delivery of every event to the webhooks subscribed to it,
+// the Sender posts them afterwards
+type Sink struct {
+	Store database.WebhookStore
+}
+
+func (s Sink) Publish(ctx context.Context, event models.Event) error {
+	_, err := s.Store.EnqueueDeliveriesQuery(event)
+	return err
+}
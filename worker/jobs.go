@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jain-chetan/companyservice/apperror"
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/logger"
+	models "github.com/jain-chetan/companyservice/model"
+	"github.com/jain-chetan/companyservice/transfer"
+)
+
+// JobStore is what the jobs need of the store, the imports create the companies
+type JobStore interface {
+	database.JobStore
+	database.CompanyStore
+}
+
+// Jobs runs the background jobs, several workers run them at once by sharing it
+type Jobs struct {
+	Store JobStore
+	// Lease is how long a job is left to its worker between two checkpoints
+	Lease time.Duration
+	// MaxAttempts is the number of times a job may be claimed before it fails, so that
+	// a job crashing its workers or never done within its lease doesn't run forever
+	MaxAttempts int
+	// ChunkSize is the number of rows an import applies between two checkpoints,
+	// transfer.DefaultChunkSize when zero
+	ChunkSize int
+}
+
+// Run claims the jobs waiting and runs them one after the other, until none is left or the context is done
+func (j *Jobs) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		claimed, ok, err := j.Store.ClaimJobQuery(j.Lease)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		j.run(ctx, claimed)
+	}
+	return nil
+}
+
+// run runs a job claimed and records how it ended
+func (j *Jobs) run(ctx context.Context, claimed database.ClaimedJob) {
+	logger.Infof("Running the %s job %s, attempt %d", claimed.Type, claimed.ID, claimed.Attempts)
+
+	report := claimed.Report
+	var err error
+	switch {
+	case j.MaxAttempts > 0 && claimed.Attempts > j.MaxAttempts:
+		err = apperror.New(apperror.Internal, "The job was given up after %d attempts, its workers stopped before it finished", j.MaxAttempts)
+	case claimed.Type == models.JobImport:
+		report, err = j.runImport(ctx, claimed)
+	default:
+		err = apperror.New(apperror.Validation, "Unknown job type %q", claimed.Type)
+	}
+
+	switch {
+	case errors.Is(err, database.ErrJobLeaseLost):
+		logger.Infof("Stopped the job %s, it was cancelled or taken over by another worker", claimed.ID)
+		return
+	case ctx.Err() != nil:
+		// the worker is stopping, the next one resumes the job from its last checkpoint
+		if err := j.Store.ReleaseJobQuery(claimed.Lease); err != nil {
+			logger.Errorf("Unable to release the job %s. %v", claimed.ID, err)
+		}
+		logger.Infof("Stopped the job %s after %d rows, it resumes on the next start", claimed.ID, report.Rows)
+		return
+	}
+
+	status := models.JobSucceeded
+	var problem *apperror.Problem
+	if err != nil {
+		status = models.JobFailed
+		p := apperror.ProblemOf(err)
+		problem = &p
+		if p.Status >= http.StatusInternalServerError {
+			logger.Errorf("The job %s failed. %v", claimed.ID, err)
+		}
+	}
+	if err := j.Store.FinishJobQuery(claimed.Lease, status, report, problem); err != nil {
+		logger.Errorf("Unable to finish the job %s. %v", claimed.ID, err)
+		return
+	}
+	logger.Infof("The job %s %s: %d rows, %d created, %d updated, %d failed", claimed.ID, status, report.Rows, report.Created, report.Updated, report.Failed)
+}
+
+// runImport imports the input of a job, from the row its last checkpoint stopped at
+func (j *Jobs) runImport(ctx context.Context, claimed database.ClaimedJob) (models.ImportReport, error) {
+	params := claimed.Params
+	report := claimed.Report
+	report.DryRun = params.DryRun
+
+	format, err := transfer.ParseFormat(params.Format)
+	if err != nil {
+		return report, err
+	}
+	reader, err := transfer.NewReader(format, bytes.NewReader(claimed.Input))
+	if err != nil {
+		return report, err
+	}
+
+	actor := models.Actor{Subject: claimed.CreatedBy, RequestID: claimed.RequestID}
+	lease := claimed.Lease
+	return transfer.Import(ctx, j.Store, actor, reader, transfer.Options{
+		DryRun:    params.DryRun,
+		Upsert:    params.Upsert,
+		ChunkSize: j.ChunkSize,
+		Lease:     &lease,
+		Resume:    &report,
+	})
+}
@@ -0,0 +1,184 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// hookStore calls after once every batch of companies is applied, with the count of batches so far
+type hookStore struct {
+	*database.MemoryStore
+	batches int
+	after   func(batch int)
+}
+
+func (s *hookStore) BatchCompaniesQuery(actor models.Actor, ops []models.CompanyOperation, options database.BatchOptions) ([]database.OperationResult, error) {
+	results, err := s.MemoryStore.BatchCompaniesQuery(actor, ops, options)
+	s.batches++
+	if s.after != nil {
+		s.after(s.batches)
+	}
+	return results, err
+}
+
+// queueImport queues the import of a csv file of companies named Company 1 to Company n
+func queueImport(t *testing.T, store *database.MemoryStore, n int) uuid.UUID {
+	t.Helper()
+	var input strings.Builder
+	input.WriteString("name,type\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&input, "Company %d,Corporation\n", i)
+	}
+	job, err := store.CreateJobQuery(models.Job{Type: models.JobImport, Params: models.ImportParams{Format: "csv"}, CreatedBy: "user-1"}, []byte(input.String()))
+	if err != nil {
+		t.Fatalf("queue the job: %v", err)
+	}
+	return job.ID
+}
+
+// getJob returns a job and the names of the companies in the store
+func getJob(t *testing.T, store *database.MemoryStore, id uuid.UUID) (models.Job, []string) {
+	t.Helper()
+	job, err := store.GetJobQuery(id)
+	if err != nil {
+		t.Fatalf("get the job: %v", err)
+	}
+	companies, _, err := store.ListCompaniesQuery(models.CompanyFilter{Limit: 100})
+	if err != nil {
+		t.Fatalf("list the companies: %v", err)
+	}
+	var names []string
+	for _, company := range companies {
+		names = append(names, company.Name)
+	}
+	return job, names
+}
+
+func TestJobResumesFromItsCheckpoint(t *testing.T) {
+	store := database.NewMemoryStore()
+	id := queueImport(t, store, 5)
+
+	// the worker stops once the first chunk is applied, as on a shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	hooked := &hookStore{MemoryStore: store, after: func(int) { cancel() }}
+	if err := (&Jobs{Store: hooked, Lease: time.Minute, ChunkSize: 2}).Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	job, names := getJob(t, store, id)
+	if job.Status != models.JobRunning || job.Report.Rows != 2 || job.Report.Created != 2 || len(names) != 2 {
+		t.Fatalf("got the job %s with %d rows and %d created, %d companies, want the first chunk saved", job.Status, job.Report.Rows, job.Report.Created, len(names))
+	}
+	if job.Attempts != 0 {
+		t.Errorf("got %d attempts, want the attempt given back", job.Attempts)
+	}
+
+	// the next worker reads the first chunk again for its names only
+	if err := (&Jobs{Store: store, Lease: time.Minute, ChunkSize: 2}).Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	job, names = getJob(t, store, id)
+	if job.Status != models.JobSucceeded || job.Report.Rows != 5 || job.Report.Created != 5 || job.Report.Failed != 0 {
+		t.Errorf("got the job %s with %d rows, %d created and %d failed, want 5 rows created", job.Status, job.Report.Rows, job.Report.Created, job.Report.Failed)
+	}
+	if len(names) != 5 {
+		t.Errorf("got the companies %v, want 5", names)
+	}
+}
+
+func TestJobLeaseExpiresMidImport(t *testing.T) {
+	store := database.NewMemoryStore()
+	id := queueImport(t, store, 5)
+
+	// the first worker stalls after its first chunk until its lease expires, a second worker
+	// takes the job over and finishes it meanwhile
+	second := &Jobs{Store: store, Lease: time.Minute, ChunkSize: 2}
+	hooked := &hookStore{MemoryStore: store, after: func(batch int) {
+		if batch == 1 {
+			time.Sleep(10 * time.Millisecond)
+			if err := second.Run(context.Background()); err != nil {
+				t.Errorf("run the second worker: %v", err)
+			}
+		}
+	}}
+	if err := (&Jobs{Store: hooked, Lease: 5 * time.Millisecond, ChunkSize: 2}).Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if hooked.batches != 2 {
+		t.Errorf("the first worker applied %d chunks, want it stopped by the lease lost at its second", hooked.batches)
+	}
+
+	// the chunk of the first worker after it lost the lease is rolled back with its checkpoint
+	job, names := getJob(t, store, id)
+	if job.Status != models.JobSucceeded || job.Attempts != 2 {
+		t.Fatalf("got the job %s after %d attempts, want it succeeded after 2", job.Status, job.Attempts)
+	}
+	if job.Report.Rows != 5 || job.Report.Created != 5 || job.Report.Failed != 0 {
+		t.Errorf("got %d rows, %d created and %d failed, want 5 rows created: %+v", job.Report.Rows, job.Report.Created, job.Report.Failed, job.Report.Errors)
+	}
+	if len(names) != 5 {
+		t.Errorf("got the companies %v, want each of the 5 once", names)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	store := database.NewMemoryStore()
+	id := queueImport(t, store, 5)
+
+	hooked := &hookStore{MemoryStore: store, after: func(batch int) {
+		if batch == 1 {
+			if _, err := store.CancelJobQuery(id); err != nil {
+				t.Errorf("cancel: %v", err)
+			}
+		}
+	}}
+	if err := (&Jobs{Store: hooked, Lease: time.Minute, ChunkSize: 2}).Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// the worker stops at its next checkpoint, the chunks applied before the cancellation are kept
+	job, names := getJob(t, store, id)
+	if job.Status != models.JobCancelled || job.Report.Rows != 2 {
+		t.Errorf("got the job %s with %d rows, want it cancelled after the first chunk", job.Status, job.Report.Rows)
+	}
+	if len(names) != 2 {
+		t.Errorf("got the companies %v, want the 2 of the first chunk", names)
+	}
+	if hooked.batches != 2 {
+		t.Errorf("the worker applied %d chunks, want it stopped at the second", hooked.batches)
+	}
+}
+
+func TestJobFailsAfterMaxAttempts(t *testing.T) {
+	store := database.NewMemoryStore()
+	id := queueImport(t, store, 3)
+
+	// the workers taking the job crash before their first checkpoint
+	for i := 0; i < 3; i++ {
+		if _, ok, err := store.ClaimJobQuery(time.Millisecond); err != nil || !ok {
+			t.Fatalf("claim %d: got %t, %v", i, ok, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if err := (&Jobs{Store: store, Lease: time.Minute, MaxAttempts: 3}).Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	job, names := getJob(t, store, id)
+	if job.Status != models.JobFailed || job.Error == nil || job.Attempts != 4 {
+		t.Fatalf("got the job %s after %d attempts with error %v, want it failed", job.Status, job.Attempts, job.Error)
+	}
+	if len(names) != 0 {
+		t.Errorf("got the companies %v, want none", names)
+	}
+	if _, ok, err := store.ClaimJobQuery(time.Minute); err != nil || ok {
+		t.Errorf("claim: got %t, %v, want no job left", ok, err)
+	}
+}
@@ -0,0 +1,23 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/logger"
+)
+
+// Purge permanently deletes the companies deleted for longer than the retention
+func Purge(store database.CompanyStore, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := store.PurgeCompaniesQuery(time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logger.Infof("Purged %d companies deleted more than %v ago", count, retention)
+		}
+		return nil
+	}
+}
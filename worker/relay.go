@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/events"
+	"github.com/jain-chetan/companyservice/logger"
+	"github.com/jain-chetan/companyservice/webhook"
+)
+
+// Relay publishes the pending events of the outbox to the sink. An event failing is tried
+// again with an exponential backoff and parked once out of attempts, the events after it
+// are published meanwhile so they may reach the sink out of order.
+type Relay struct {
+	Store database.OutboxStore
+	Sink  events.Sink
+	// MaxAttempts is the number of attempts before an event is parked
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled for every next one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease keeps the events claimed from the other relays while they are published
+	Lease     time.Duration
+	BatchSize int
+}
+
+// Run publishes the events due, a batch at a time until none is left, for worker.Every
+func (r *Relay) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// no row stays locked while the events are published
+		pending, err := r.Store.ClaimEventsQuery(r.BatchSize, r.Lease)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range pending {
+			err := r.Sink.Publish(ctx, event.Event)
+			// an event interrupted by the shutdown is left to its lease and published again
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			publishErr := ""
+			var next *time.Time
+			if err != nil {
+				publishErr = err.Error()
+				if attempt := event.Attempts + 1; attempt < r.MaxAttempts {
+					at := time.Now().Add(webhook.Backoff(attempt, r.Backoff, r.MaxBackoff))
+					next = &at
+				} else {
+					logger.Warnf("Event %s of company %s is parked after %d attempts. %v", event.ID, event.CompanyID, attempt, err)
+				}
+			}
+			if err := r.Store.RecordEventAttemptQuery(event.ID, publishErr, next); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < r.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	database "github.com/jain-chetan/companyservice/database"
+	"github.com/jain-chetan/companyservice/events"
+	models "github.com/jain-chetan/companyservice/model"
+
+	"github.com/google/uuid"
+)
+
+// failingSink fails to publish once it has published a number of events
+type failingSink struct {
+	events.Sink
+	left int
+}
+
+func (s *failingSink) Publish(ctx context.Context, event models.Event) error {
+	if s.left == 0 {
+		return errors.New("broker unavailable")
+	}
+	s.left--
+	return s.Sink.Publish(ctx, event)
+}
+
+// rejectingSink always fails to publish the events of a company and counts the attempts
+type rejectingSink struct {
+	events.Sink
+	company  uuid.UUID
+	attempts int
+}
+
+func (s *rejectingSink) Publish(ctx context.Context, event models.Event) error {
+	if event.CompanyID == s.company {
+		s.attempts++
+		return errors.New("rejected by the broker")
+	}
+	return s.Sink.Publish(ctx, event)
+}
+
+// newRelay returns a relay retrying the failed events after a millisecond
+func newRelay(store database.OutboxStore, sink events.Sink, batchSize int) *Relay {
+	return &Relay{
+		Store:       store,
+		Sink:        sink,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Lease:       time.Minute,
+		BatchSize:   batchSize,
+	}
+}
+
+func TestRelayPublishesTheOutbox(t *testing.T) {
+	store := database.NewMemoryStore()
+	actor := models.Actor{Subject: "user-1", RequestID: "request-1"}
+
+	var ids []uuid.UUID
+	for _, name := range []string{"Acme", "Globex", "Initech"} {
+		id, err := store.CreateCompanyQuery(actor, models.Company{Name: name, Type: models.Corporation})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+	acme, err := store.GetCompanyQuery(ids[0])
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	acme.Employees = 7
+	if _, err := store.PatchCompanyQuery(actor, acme.ID, acme); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if err := store.DeleteCompanyQuery(actor, acme.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	sink := events.NewMemorySink()
+	// the events failing in the first run are kept for the next one
+	if err := newRelay(store, &failingSink{Sink: sink, left: 2}, 2).Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := len(sink.Events()); got != 2 {
+		t.Fatalf("relay: got %d events published before the failure, want 2", got)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := newRelay(store, sink, 2).Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+
+	published := sink.Events()
+	want := []struct {
+		typ     models.EventType
+		company uuid.UUID
+	}{
+		{models.CompanyCreated, ids[0]},
+		{models.CompanyCreated, ids[1]},
+		{models.CompanyCreated, ids[2]},
+		{models.CompanyUpdated, ids[0]},
+		{models.CompanyDeleted, ids[0]},
+	}
+	if len(published) != len(want) {
+		t.Fatalf("relay: got %d events, want %d", len(published), len(want))
+	}
+	for i, event := range published {
+		if event.Type != want[i].typ || event.CompanyID != want[i].company {
+			t.Errorf("event %d: got %s of %s, want %s of %s", i, event.Type, event.CompanyID, want[i].typ, want[i].company)
+		}
+		if event.Subject != actor.Subject || event.RequestID != actor.RequestID {
+			t.Errorf("event %d: got subject %q and request id %q, want the actor", i, event.Subject, event.RequestID)
+		}
+	}
+	if published[3].Company == nil || published[3].Company.Employees != 7 {
+		t.Errorf("update event: got company %+v, want the state after the change", published[3].Company)
+	}
+
+	// every event is published once
+	if err := newRelay(store, sink, 2).Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := len(sink.Events()); got != len(want) {
+		t.Errorf("relay: got %d events after an empty run, want %d", got, len(want))
+	}
+}
+
+func TestRelayParksAnEventAlwaysFailing(t *testing.T) {
+	store := database.NewMemoryStore()
+	actor := models.Actor{Subject: "user-1"}
+
+	var ids []uuid.UUID
+	for _, name := range []string{"Acme", "Globex", "Initech"} {
+		id, err := store.CreateCompanyQuery(actor, models.Company{Name: name, Type: models.Corporation})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+
+	// the event of the first company never goes through, the others don't wait for it
+	sink := &rejectingSink{Sink: events.NewMemorySink(), company: ids[0]}
+	relay := newRelay(store, sink, 10)
+	if err := relay.Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	published := sink.Sink.(*events.MemorySink).Events()
+	if len(published) != 2 || published[0].CompanyID != ids[1] || published[1].CompanyID != ids[2] {
+		t.Fatalf("relay: got %d events published, want the 2 after the failing one", len(published))
+	}
+
+	for run := 0; run < 5; run++ {
+		time.Sleep(2 * time.Millisecond)
+		if err := relay.Run(context.Background()); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+	}
+	if sink.attempts != relay.MaxAttempts {
+		t.Errorf("got %d attempts, want the event parked after %d", sink.attempts, relay.MaxAttempts)
+	}
+	pending, err := store.ClaimEventsQuery(10, time.Minute)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("got %d events still pending, want the failing one parked", len(pending))
+	}
+
+	// the events written afterwards are still published
+	if _, err := store.CreateCompanyQuery(actor, models.Company{Name: "Umbrella", Type: models.Corporation}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := relay.Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := len(sink.Sink.(*events.MemorySink).Events()); got != 3 {
+		t.Errorf("got %d events published, want 3", got)
+	}
+}
+
+func TestMultiPublishesToEverySink(t *testing.T) {
+	store := database.NewMemoryStore()
+	id, err := store.CreateCompanyQuery(models.Actor{}, models.Company{Name: "Acme", Type: models.Corporation})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// a broken sink doesn't keep the event from the one after it
+	working := events.NewMemorySink()
+	broken := &rejectingSink{Sink: events.NewMemorySink(), company: id}
+	if err := newRelay(store, events.Multi{broken, working}, 10).Run(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if got := len(working.Events()); got != 1 {
+		t.Errorf("got %d events published to the working sink, want 1", got)
+	}
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jain-chetan/companyservice/logger"
+)
+
+// Every runs fn at every interval until the context is done, starting right away.
+// The errors are logged, the next run happens all the same.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Debugf("Started %s, every %v", name, interval)
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logger.Errorf("%s failed. %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			logger.Debugf("Stopped %s", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}